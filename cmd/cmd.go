@@ -36,20 +36,24 @@ func Run() {
 		StringVar(&c.Init.ManifestName)
 	repoInit.Flag("manifest-url", "manifest repository location").Short('u').Required().
 		StringVar(&c.Init.ManifestUrl)
+	repoInit.Flag("groups", "restrict manifest projects to ones with specified group(s) [default|all|G1,G2,G3|G4,-G5,-G6]").
+		Short('g').StringVar(&c.Init.Groups)
 	repoInit.Flag("depth", "create a shallow clone with a history in the specific depth").
 		IntVar(&c.Init.Depth)
 	repoInit.Flag("repo-url", "repo repository location").Default("https://gerrit.googlesource.com/git-repo.git").
 		StringVar(&c.Init.RepoUrl)
 	repoInit.Flag("tag-since", "create a shallow clone with a history after the specific tag").
 		StringVar(&c.Init.TagSince)
+	repoInit.Flag("tag-nearest", "fall back to the nearest tag in projects without the tag-since tag").
+		BoolVar(&c.Init.TagNearest)
 	repoInit.Flag("time-since", "create a shallow clone with a historoy after the specific time (format: yyyy-MM-ddTHH:mm:ss)").
 		StringVar(&c.Init.TimeSince)
-	repoInit.Flag("gitiles-pass", "gitiles password").Default("pass").
-		StringVar(&c.Gitiles.Pass)
-	repoInit.Flag("gitiles-url", "gitiles location").Default("localhost:80").
-		StringVar(&c.Gitiles.Url)
-	repoInit.Flag("gitiles-user", "gitiles user").Default("user").
-		StringVar(&c.Gitiles.User)
+	repoInit.Flag("verify-keyring", "verify the manifest, its includes and local manifests against the keyring of trusted signers").
+		StringVar(&c.Init.VerifyKeyring)
+	repoInit.Flag("verify-format", "signature format (openpgp, ssh)").Default(repo.FormatOpenPGP).
+		EnumVar(&c.Init.VerifyFormat, repo.FormatOpenPGP, repo.FormatSSH)
+	gitilesFlags(repoInit)
+	logFlags(repoInit)
 
 	repoSync := app.Command("sync", "Update working tree to the latest revision").Action(syncAction)
 	repoSync.Flag("jobs", "projects to fetch simultaneously").Short('j').Default("1").
@@ -57,9 +61,35 @@ func Run() {
 	repoSync.Flag("verbose", "show all sync output").Short('v').Default("false").
 		BoolVar(&c.Sync.Verbose)
 
+	exportCommand(app)
+	listCommand(app)
+	manifestCommand(app)
+
 	kingpin.MustParse(app.Parse(os.Args[1:]))
 }
 
+func gitilesFlags(cmd *kingpin.CmdClause) {
+	cmd.Flag("gitiles-pass", "gitiles password").Default("pass").
+		StringVar(&c.Gitiles.Pass)
+	cmd.Flag("gitiles-url", "gitiles location").Default("localhost:80").
+		StringVar(&c.Gitiles.Url)
+	cmd.Flag("gitiles-user", "gitiles user").Default("user").
+		StringVar(&c.Gitiles.User)
+}
+
+// logFlags registers the flags of the commands walking gitiles logs.
+func logFlags(cmd *kingpin.CmdClause) {
+	cmd.Flag("gitiles-max-pages", "gitiles log pages to walk at most per project (0 for no limit)").Default("100").
+		IntVar(&c.Gitiles.MaxPages)
+}
+
+func signFlags(cmd *kingpin.CmdClause) {
+	cmd.Flag("sign-key", "sign the manifest written with the key (gpg key ID or SSH private key file)").
+		StringVar(&c.Sign.Key)
+	cmd.Flag("sign-format", "signature format (openpgp, ssh)").Default(repo.FormatOpenPGP).
+		EnumVar(&c.Sign.Format, repo.FormatOpenPGP, repo.FormatSSH)
+}
+
 func initAction(_ *kingpin.ParseContext) error {
 	if err := r.Check(); err != nil {
 		return err
@@ -0,0 +1,41 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"github.com/pkg/errors"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+func exportCommand(app *kingpin.Application) {
+	export := app.Command("export", "Export source of manifest projects without history").Action(exportAction)
+	export.Flag("archive", "download project archives via gitiles").Default("false").
+		BoolVar(&c.Export.Archive)
+	export.Flag("manifest", "manifest file overlaid with local manifests, or gitiles:PROJECT/+/REVISION/PATH").
+		Default(".repo/manifest.xml").StringVar(&c.Export.Manifest)
+	export.Flag("output", "directory to export projects into").Short('o').Default(".").
+		StringVar(&c.Export.Output)
+	export.Flag("groups", "export projects in specified group(s) [default|all|G1,G2,G3|G4,-G5,-G6]").Short('g').
+		StringVar(&c.Export.Groups)
+	export.Flag("jobs", "projects to download simultaneously").Short('j').Default("4").
+		IntVar(&c.Export.Jobs)
+	gitilesFlags(export)
+}
+
+func exportAction(_ *kingpin.ParseContext) error {
+	if !c.Export.Archive {
+		return errors.New("mode required: --archive")
+	}
+
+	return r.Export(c.Export.Manifest, c.Export.Output, c.Export.Groups, c.Export.Jobs, &c.Gitiles)
+}
@@ -0,0 +1,137 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"gorepo/manifest"
+)
+
+var columns = map[string]func(manifest.Entry) string{
+	"clone-depth": func(e manifest.Entry) string { return e.CloneDepth },
+	"groups":      func(e manifest.Entry) string { return e.Groups },
+	"name":        func(e manifest.Entry) string { return e.Name },
+	"path":        func(e manifest.Entry) string { return e.Path },
+	"remote":      func(e manifest.Entry) string { return e.Remote },
+	"revision":    func(e manifest.Entry) string { return e.Revision },
+	"type":        func(e manifest.Entry) string { return e.Type },
+	"upstream":    func(e manifest.Entry) string { return e.Upstream },
+}
+
+func listCommand(app *kingpin.Application) {
+	list := app.Command("list", "List projects of the effective manifest").Action(listAction)
+	list.Flag("manifest", "manifest file overlaid with local manifests, or gitiles:PROJECT/+/REVISION/PATH").
+		Default(".repo/manifest.xml").StringVar(&c.List.Manifest)
+	list.Flag("groups", "list projects in specified group(s) [default|all|G1,G2,G3|G4,-G5,-G6]").Short('g').
+		StringVar(&c.List.Groups)
+	list.Flag("name", "list projects with name matching regex").
+		StringVar(&c.List.Name)
+	list.Flag("path", "list projects with path matching regex").
+		StringVar(&c.List.Path)
+	list.Flag("remote", "list projects of remote").
+		StringVar(&c.List.Remote)
+	list.Flag("type", "list projects with revision of type (sha, branch, tag)").
+		EnumVar(&c.List.Type, manifest.TypeSha, manifest.TypeBranch, manifest.TypeTag)
+	list.Flag("columns", "columns to print (name, path, remote, revision, type, groups, upstream, clone-depth)").
+		Default("path,name,revision").StringVar(&c.List.Columns)
+	list.Flag("json", "print projects in JSON").Default("false").
+		BoolVar(&c.List.Json)
+	list.Flag("format", "print projects with Go template, like {{.Path}}:{{.Revision}}").
+		StringVar(&c.List.Format)
+	gitilesFlags(list)
+}
+
+func listAction(_ *kingpin.ParseContext) error {
+	m, err := r.LoadManifest(c.List.Manifest, &c.Gitiles)
+	if err != nil {
+		return err
+	}
+
+	if !r.IsGitiles(c.List.Manifest) {
+		if err := m.Overlay(manifest.LocalDir(c.List.Manifest)); err != nil {
+			return err
+		}
+	}
+
+	entries, err := m.List(manifest.Query{
+		Groups: c.List.Groups,
+		Name:   c.List.Name,
+		Path:   c.List.Path,
+		Remote: c.List.Remote,
+		Type:   c.List.Type,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case c.List.Json:
+		if entries == nil {
+			entries = []manifest.Entry{}
+		}
+		return printJson(entries)
+	case c.List.Format != "":
+		return printTemplate(entries, c.List.Format)
+	}
+
+	return printColumns(entries, c.List.Columns)
+}
+
+func printTemplate(entries []manifest.Entry, format string) error {
+	t, err := template.New("list").Parse(format)
+	if err != nil {
+		return errors.Wrap(err, "format invalid")
+	}
+
+	for _, val := range entries {
+		if err := t.Execute(os.Stdout, val); err != nil {
+			return errors.Wrap(err, "execute failed")
+		}
+		fmt.Println()
+	}
+
+	return nil
+}
+
+func printColumns(entries []manifest.Entry, names string) error {
+	var buf []func(manifest.Entry) string
+
+	for _, val := range strings.Split(names, ",") {
+		column, ok := columns[strings.TrimSpace(val)]
+		if !ok {
+			return errors.New("column " + val + " invalid")
+		}
+		buf = append(buf, column)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	for _, val := range entries {
+		var line []string
+		for _, column := range buf {
+			line = append(line, column(val))
+		}
+		fmt.Fprintln(w, strings.Join(line, "\t"))
+	}
+
+	return w.Flush()
+}
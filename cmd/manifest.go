@@ -0,0 +1,406 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"gorepo/manifest"
+	"gorepo/repo"
+)
+
+const (
+	formatJson     = "json"
+	formatMarkdown = "markdown"
+	formatText     = "text"
+)
+
+func manifestCommand(app *kingpin.Application) {
+	m := app.Command("manifest", "Manage manifest files")
+
+	convert := m.Command("convert", "Convert manifests between XML, JSON and YAML").Action(convertAction)
+	convert.Arg("name", "manifest file (format by extension)").Required().
+		StringVar(&c.Convert.Name)
+	convert.Flag("output", "converted manifest file (print to stdout if empty)").Short('o').
+		StringVar(&c.Convert.Output)
+	convert.Flag("format", "output format (json, xml, yaml), defaults to the one of output").
+		EnumVar(&c.Convert.Format, manifest.FormatJson, manifest.FormatXml, manifest.FormatYaml)
+	convert.Flag("expand", "expand includes of XML manifests").Default("false").
+		BoolVar(&c.Convert.Expand)
+
+	diff := m.Command("diff", "Show changes between manifests").Action(diffAction)
+	diff.Arg("old", "old manifest file or gitiles:PROJECT/+/REVISION/PATH").Required().
+		StringVar(&c.Diff.Old)
+	diff.Arg("new", "new manifest file or gitiles:PROJECT/+/REVISION/PATH").Required().
+		StringVar(&c.Diff.New)
+	diff.Flag("format", "output format (text, json, markdown)").Default(formatText).
+		EnumVar(&c.Diff.Format, formatText, formatJson, formatMarkdown)
+	gitilesFlags(diff)
+
+	_fmt := m.Command("fmt", "Rewrite manifests in the canonical form").Action(fmtAction)
+	_fmt.Arg("names", "manifest files").Required().
+		StringsVar(&c.Fmt.Names)
+	_fmt.Flag("check", "only list manifests not in the canonical form, failing if any").Default("false").
+		BoolVar(&c.Fmt.Check)
+
+	generate := m.Command("generate", "Generate a manifest from git repositories in a directory").Action(generateAction)
+	generate.Arg("dir", "directory to scan").Required().
+		StringVar(&c.Generate.Dir)
+	generate.Flag("output", "generated manifest file (print to stdout if empty)").Short('o').
+		StringVar(&c.Generate.Output)
+
+	lint := m.Command("lint", "Check manifests against revision policies").Action(lintAction)
+	lint.Arg("name", "manifest file").Required().
+		StringVar(&c.Lint.Name)
+	lint.Flag("policy", "policy file (JSON or YAML)").Short('p').Required().
+		StringVar(&c.Lint.Policy)
+	lint.Flag("json", "print violations in JSON").Default("false").
+		BoolVar(&c.Lint.Json)
+
+	merge := m.Command("merge", "Merge manifests from left to right").Action(mergeAction)
+	merge.Arg("names", "manifest files").Required().
+		StringsVar(&c.Merge.Names)
+	merge.Flag("output", "merged manifest file").Short('o').Required().
+		StringVar(&c.Merge.Output)
+	merge.Flag("policy", "conflict policy (prefer-left, prefer-right, fail, highest-revision-wins)").
+		Default(manifest.PolicyFail).
+		EnumVar(&c.Merge.Policy, manifest.PolicyLeft, manifest.PolicyRight, manifest.PolicyFail, manifest.PolicyHighest)
+	merge.Flag("json", "print conflicts in JSON").Default("false").
+		BoolVar(&c.Merge.Json)
+
+	pin := m.Command("pin", "Pin project revisions to commits via Gitiles").Action(pinAction)
+	pin.Arg("name", "manifest file or gitiles:PROJECT/+/REVISION/PATH").Required().
+		StringVar(&c.Pin.Name)
+	pin.Flag("output", "pinned manifest file").Short('o').Required().
+		StringVar(&c.Pin.Output)
+	pin.Flag("jobs", "projects to resolve simultaneously").Short('j').Default("1").
+		IntVar(&c.Pin.Jobs)
+	pin.Flag("time", "pin to the last commits at or before the specific time (format: yyyy-MM-ddTHH:mm:ss)").
+		StringVar(&c.Pin.Time)
+	gitilesFlags(pin)
+	logFlags(pin)
+	signFlags(pin)
+
+	rewrite := m.Command("rewrite", "Rewrite projects by rules").Action(rewriteAction)
+	rewrite.Arg("name", "manifest file").Required().
+		StringVar(&c.Rewrite.Name)
+	rewrite.Flag("rules", "rules file (JSON or YAML)").Short('r').Required().
+		StringVar(&c.Rewrite.Rules)
+	rewrite.Flag("output", "rewritten manifest file (not the manifest file itself)").Short('o').Required().
+		StringVar(&c.Rewrite.Output)
+	signFlags(rewrite)
+
+	sign := m.Command("sign", "Sign manifests with a detached signature").Action(signAction)
+	sign.Arg("name", "manifest file").Required().
+		StringVar(&c.Sign.Name)
+	sign.Flag("key", "gpg key ID or SSH private key file").Short('k').
+		StringVar(&c.Sign.Key)
+	sign.Flag("format", "signature format (openpgp, ssh)").Default(repo.FormatOpenPGP).
+		EnumVar(&c.Sign.Format, repo.FormatOpenPGP, repo.FormatSSH)
+
+	validate := m.Command("validate", "Validate manifest structure").Action(validateAction)
+	validate.Arg("name", "manifest file").Required().
+		StringVar(&c.Validate.Name)
+	validate.Flag("json", "print violations in JSON").Default("false").
+		BoolVar(&c.Validate.Json)
+
+	verify := m.Command("verify", "Verify detached signatures of manifests and their includes").Action(verifyAction)
+	verify.Arg("name", "manifest file").Required().
+		StringVar(&c.Verify.Name)
+	verify.Flag("keyring", "keyring of trusted signers (gpg public keys or SSH allowed signers)").Short('k').Required().
+		StringVar(&c.Verify.Keyring)
+	verify.Flag("format", "signature format (openpgp, ssh)").Default(repo.FormatOpenPGP).
+		EnumVar(&c.Verify.Format, repo.FormatOpenPGP, repo.FormatSSH)
+}
+
+func convertAction(_ *kingpin.ParseContext) error {
+	m := manifest.Manifest{}
+
+	if c.Convert.Expand && manifest.Format(c.Convert.Name) == manifest.FormatXml {
+		if err := m.Load(c.Convert.Name); err != nil {
+			return err
+		}
+	} else if err := m.Read(c.Convert.Name); err != nil {
+		return err
+	}
+
+	format := c.Convert.Format
+	if format == "" {
+		format = formatJson
+		if c.Convert.Output != "" {
+			format = manifest.Format(c.Convert.Output)
+		}
+	}
+
+	buf, err := m.Encode(format)
+	if err != nil {
+		return err
+	}
+
+	if c.Convert.Output == "" {
+		fmt.Print(string(buf))
+		return nil
+	}
+
+	return os.WriteFile(c.Convert.Output, buf, 0644)
+}
+
+func diffAction(_ *kingpin.ParseContext) error {
+	o, err := r.LoadManifest(c.Diff.Old, &c.Gitiles)
+	if err != nil {
+		return err
+	}
+
+	n, err := r.LoadManifest(c.Diff.New, &c.Gitiles)
+	if err != nil {
+		return err
+	}
+
+	d := manifest.Compare(&o, &n)
+
+	switch c.Diff.Format {
+	case formatJson:
+		return printJson(d)
+	case formatMarkdown:
+		fmt.Print(d.Markdown())
+	default:
+		fmt.Print(d.Text())
+	}
+
+	return nil
+}
+
+func fmtAction(_ *kingpin.ParseContext) error {
+	var failed bool
+
+	for _, val := range c.Fmt.Names {
+		changed, err := manifest.FormatFile(val, c.Fmt.Check)
+		if err != nil {
+			return errors.Wrap(err, val)
+		}
+		if changed {
+			fmt.Println(val)
+			failed = true
+		}
+	}
+
+	if c.Fmt.Check && failed {
+		return errors.New("manifest not canonical")
+	}
+
+	return nil
+}
+
+func generateAction(_ *kingpin.ParseContext) error {
+	m, err := r.Generate(c.Generate.Dir)
+	if err != nil {
+		return err
+	}
+
+	if c.Generate.Output != "" {
+		return m.Write(c.Generate.Output)
+	}
+
+	buf, err := m.Encode(manifest.FormatXml)
+	if err != nil {
+		return err
+	}
+
+	fmt.Print(string(buf))
+
+	return nil
+}
+
+func mergeAction(_ *kingpin.ParseContext) error {
+	var manifests []*manifest.Manifest
+
+	if len(c.Merge.Names) < 2 {
+		return errors.New("manifests required")
+	}
+
+	for _, val := range c.Merge.Names {
+		m := manifest.Manifest{}
+		if err := m.Load(val); err != nil {
+			return errors.Wrap(err, val)
+		}
+		manifests = append(manifests, &m)
+	}
+
+	m, conflicts, err := manifest.Merge(c.Merge.Policy, manifests...)
+
+	if c.Merge.Json {
+		if conflicts == nil {
+			conflicts = []manifest.Conflict{}
+		}
+		if err := printJson(conflicts); err != nil {
+			return err
+		}
+	} else {
+		for _, val := range conflicts {
+			fmt.Println(val.String())
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return m.Write(c.Merge.Output)
+}
+
+func pinAction(_ *kingpin.ParseContext) error {
+	var err error
+
+	if c.Pin.Time != "" {
+		err = r.PinAtTime(c.Pin.Name, c.Pin.Output, c.Pin.Time, c.Pin.Jobs, &c.Gitiles)
+	} else {
+		err = r.Pin(c.Pin.Name, c.Pin.Output, c.Pin.Jobs, &c.Gitiles)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return signOutput(c.Pin.Output)
+}
+
+func rewriteAction(_ *kingpin.ParseContext) error {
+	if sameFile(c.Rewrite.Name, c.Rewrite.Output) {
+		return errors.New("output must not be the manifest file")
+	}
+
+	rules, err := manifest.LoadRules(c.Rewrite.Rules)
+	if err != nil {
+		return err
+	}
+
+	o, m := manifest.Manifest{}, manifest.Manifest{}
+
+	if err := o.Read(c.Rewrite.Name); err != nil {
+		return err
+	}
+
+	if err := m.Read(c.Rewrite.Name); err != nil {
+		return err
+	}
+
+	if err := m.Rewrite(rules); err != nil {
+		return err
+	}
+
+	d := manifest.Compare(&o, &m)
+	fmt.Print(d.Text())
+
+	if err := m.Write(c.Rewrite.Output); err != nil {
+		return err
+	}
+
+	return signOutput(c.Rewrite.Output)
+}
+
+// sameFile reports whether a and b are the same file, or the same path if b
+// does not exist yet.
+func sameFile(a, b string) bool {
+	x, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+
+	y, err := os.Stat(b)
+	if err != nil {
+		return filepath.Clean(a) == filepath.Clean(b)
+	}
+
+	return os.SameFile(x, y)
+}
+
+func signAction(_ *kingpin.ParseContext) error {
+	return r.Sign(c.Sign.Name, c.Sign.Format, c.Sign.Key)
+}
+
+// signOutput signs the manifest written in name if a key is given.
+func signOutput(name string) error {
+	if c.Sign.Key == "" {
+		return nil
+	}
+
+	return r.Sign(name, c.Sign.Format, c.Sign.Key)
+}
+
+func lintAction(_ *kingpin.ParseContext) error {
+	policies, err := r.LoadPolicies(c.Lint.Policy)
+	if err != nil {
+		return err
+	}
+
+	violations, err := r.Lint(c.Lint.Name, policies)
+	if err != nil {
+		return err
+	}
+
+	return printViolations(violations, c.Lint.Json)
+}
+
+func validateAction(_ *kingpin.ParseContext) error {
+	violations, err := manifest.Validate(c.Validate.Name)
+	if err != nil {
+		return err
+	}
+
+	return printViolations(violations, c.Validate.Json)
+}
+
+// printViolations prints violations, and fails if any of them is an error.
+func printViolations(violations []manifest.Violation, _json bool) error {
+	if _json {
+		if violations == nil {
+			violations = []manifest.Violation{}
+		}
+		if err := printJson(violations); err != nil {
+			return err
+		}
+	} else {
+		for _, val := range violations {
+			fmt.Println(val.String())
+		}
+	}
+
+	for _, val := range violations {
+		if val.Severity == manifest.Error {
+			return errors.New("manifest invalid")
+		}
+	}
+
+	return nil
+}
+
+func verifyAction(_ *kingpin.ParseContext) error {
+	return r.VerifyManifest(c.Verify.Name, "", c.Verify.Format, c.Verify.Keyring)
+}
+
+func printJson(v interface{}) error {
+	buf, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "marshal failed")
+	}
+
+	fmt.Println(string(buf))
+
+	return nil
+}
@@ -13,28 +13,132 @@
 package config
 
 type Config struct {
-	Gitiles Gitiles
-	Init    Init
-	Sync    Sync
+	Convert  Convert
+	Diff     Diff
+	Export   Export
+	Fmt      Fmt
+	Generate Generate
+	Gitiles  Gitiles
+	Init     Init
+	Lint     Lint
+	List     List
+	Merge    Merge
+	Pin      Pin
+	Rewrite  Rewrite
+	Sign     Sign
+	Sync     Sync
+	Validate Validate
+	Verify   Verify
+}
+
+type Convert struct {
+	Expand bool
+	Format string
+	Name   string
+	Output string
+}
+
+type Diff struct {
+	Format string
+	New    string
+	Old    string
+}
+
+type Export struct {
+	Archive  bool
+	Groups   string
+	Jobs     int
+	Manifest string
+	Output   string
+}
+
+type Fmt struct {
+	Check bool
+	Names []string
+}
+
+type Generate struct {
+	Dir    string
+	Output string
 }
 
 type Gitiles struct {
-	Pass string
-	Url  string
-	User string
+	MaxPages int
+	Pass     string
+	Url      string
+	User     string
 }
 
 type Init struct {
 	Depth          int
+	Groups         string
 	ManifestBranch string
 	ManifestName   string
 	ManifestUrl    string
 	RepoUrl        string
+	TagNearest     bool
 	TagSince       string
 	TimeSince      string
+	VerifyFormat   string
+	VerifyKeyring  string
+}
+
+type Lint struct {
+	Json   bool
+	Name   string
+	Policy string
+}
+
+type List struct {
+	Columns  string
+	Format   string
+	Groups   string
+	Json     bool
+	Manifest string
+	Name     string
+	Path     string
+	Remote   string
+	Type     string
+}
+
+type Merge struct {
+	Json   bool
+	Names  []string
+	Output string
+	Policy string
+}
+
+type Pin struct {
+	Jobs   int
+	Name   string
+	Output string
+	Time   string
+}
+
+type Rewrite struct {
+	Name   string
+	Output string
+	Rules  string
+}
+
+type Sign struct {
+	Format string
+	Key    string
+	Name   string
 }
 
 type Sync struct {
 	Jobs    int
 	Verbose bool
 }
+
+type Validate struct {
+	Json bool
+	Name string
+}
+
+type Verify struct {
+	Format  string
+	Keyring string
+	Name    string
+}
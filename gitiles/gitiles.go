@@ -13,21 +13,28 @@
 package gitiles
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/pkg/errors"
 )
 
 const (
-	urlConcat = "/+/"
-	urlFormat = "format=JSON"
-	urlHeads  = "refs/heads/"
-	urlLog    = "/+log/"
-	urlSearch = "/?s="
-	urlTags   = "refs/tags/"
+	urlArchive = "/+archive/"
+	urlConcat  = "/+/"
+	urlFormat  = "format=JSON"
+	urlText    = "format=TEXT"
+	urlHeads   = "refs/heads/"
+	urlLog     = "/+log/"
+	urlRefs    = "/+refs"
+	urlSearch  = "/?s="
+	urlSize    = "n="
+	urlTags    = "refs/tags/"
+	urlTarGz   = ".tar.gz"
 )
 
 const (
@@ -65,30 +72,36 @@ func (g *Gitiles) Init(url, user, pass string) error {
 // nolint: lll
 func (g Gitiles) Get(project, operator string) (map[string]interface{}, error) {
 	var buf map[string]interface{}
-	var err error
 
+	url, err := g.getUrl(project, operator)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := g.decode(url, &buf); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+func (g Gitiles) getUrl(project, operator string) (string, error) {
 	if project == "" || operator == "" || len(strings.Split(operator, opDelimiter)) >= opGroups {
-		return nil, errors.New("parameter invalid")
+		return "", errors.New("parameter invalid")
 	}
 
 	if strings.HasPrefix(operator, opBranch) {
 		branch := strings.TrimPrefix(operator, opBranch)
-		buf, err = g.request(g.url+"/"+project+urlConcat+urlHeads+branch+"?"+urlFormat, g.user, g.pass)
+		return g.url + "/" + project + urlConcat + urlHeads + branch + "?" + urlFormat, nil
 	} else if strings.HasPrefix(operator, opCommit) {
 		commit := strings.TrimPrefix(operator, opCommit)
-		buf, err = g.request(g.url+"/"+project+urlConcat+commit+"?"+urlFormat, g.user, g.pass)
+		return g.url + "/" + project + urlConcat + commit + "?" + urlFormat, nil
 	} else if strings.HasPrefix(operator, opTag) {
 		tag := strings.TrimPrefix(operator, opTag)
-		buf, err = g.request(g.url+"/"+project+urlConcat+urlTags+tag+"?"+urlFormat, g.user, g.pass)
-	} else {
-		err = errors.New("operator invalid")
+		return g.url + "/" + project + urlConcat + urlTags + tag + "?" + urlFormat, nil
 	}
 
-	if err != nil {
-		return nil, err
-	}
-
-	return buf, nil
+	return "", errors.New("operator invalid")
 }
 
 // Query
@@ -105,6 +118,22 @@ func (g Gitiles) Get(project, operator string) (map[string]interface{}, error) {
 //
 // nolint: gocyclo,lll
 func (g Gitiles) Query(project, operator string) (map[string]interface{}, error) {
+	var buf map[string]interface{}
+
+	url, err := g.queryUrl(project, operator)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := g.decode(url, &buf); err != nil {
+		return nil, err
+	}
+
+	return buf, nil
+}
+
+// nolint: gocyclo
+func (g Gitiles) queryUrl(project, operator string) (string, error) {
 	parser := func(op string) (string, string, string, error) {
 		var branch, commit, tag string
 
@@ -136,76 +165,276 @@ func (g Gitiles) Query(project, operator string) (map[string]interface{}, error)
 		return branch, commit, tag, nil
 	}
 
-	var buf map[string]interface{}
-	var err error
-
 	if project == "" || operator == "" {
-		return nil, errors.New("parameter invalid")
+		return "", errors.New("parameter invalid")
 	}
 
 	branch, commit, tag, err := parser(operator)
 	if err != nil {
-		return nil, err
+		return "", err
 	}
 
 	if branch != "" {
 		if commit != "" {
-			buf, err = g.request(g.url+"/"+project+urlLog+urlHeads+branch+urlSearch+commit+"&"+urlFormat, g.user, g.pass)
-		} else {
-			buf, err = g.request(g.url+"/"+project+urlLog+urlHeads+branch+"?"+urlFormat, g.user, g.pass)
+			return g.url + "/" + project + urlLog + urlHeads + branch + urlSearch + commit + "&" + urlFormat, nil
 		}
+		return g.url + "/" + project + urlLog + urlHeads + branch + "?" + urlFormat, nil
 	} else if tag != "" {
 		if commit != "" {
-			buf, err = g.request(g.url+"/"+project+urlLog+urlTags+tag+urlSearch+commit+"&"+urlFormat, g.user, g.pass)
-		} else {
-			buf, err = g.request(g.url+"/"+project+urlLog+urlTags+tag+"?"+urlFormat, g.user, g.pass)
+			return g.url + "/" + project + urlLog + urlTags + tag + urlSearch + commit + "&" + urlFormat, nil
 		}
-	} else {
-		err = errors.New("operator invalid")
+		return g.url + "/" + project + urlLog + urlTags + tag + "?" + urlFormat, nil
 	}
 
+	return "", errors.New("operator invalid")
+}
+
+// Commit returns the commit of operator, which is like the one Get accepts.
+func (g Gitiles) Commit(project, operator string) (Commit, error) {
+	var c Commit
+
+	url, err := g.getUrl(project, operator)
 	if err != nil {
+		return c, err
+	}
+
+	if err := g.decode(url, &c); err != nil {
+		return c, err
+	}
+
+	if c.Commit == "" {
+		return c, errors.New("commit invalid")
+	}
+
+	return c, nil
+}
+
+// Log returns the first page of the log of operator, which is like the one
+// Query accepts.
+func (g Gitiles) Log(project, operator string) (Log, error) {
+	return g.logPage(project, operator, 0)
+}
+
+// Logs returns the iterator over the log of operator, which is like the one
+// Query accepts, requesting pages of size commits, or the default of Gitiles
+// if size is 0. The iterator fails with ErrMaxPages rather than request more
+// than max pages, unless max is 0.
+//
+// Example:
+//
+// https://android.googlesource.com/platform/build/soong/+log/refs/heads/main/?s=42ada5cff3fca011b5a0d017955f14dc63898807&n=500&format=JSON
+//
+// nolint: lll
+func (g Gitiles) Logs(project, operator string, size, max int) *LogIterator {
+	var buf []string
+
+	for _, val := range strings.Split(operator, opDelimiter) {
+		if strings.HasPrefix(val, opCommit) {
+			continue
+		}
+		buf = append(buf, val)
+	}
+
+	return &LogIterator{
+		g:        g,
+		project:  project,
+		operator: strings.Join(buf, opDelimiter),
+		start:    operator,
+		size:     size,
+		max:      max,
+	}
+}
+
+func (g Gitiles) logPage(project, operator string, size int) (Log, error) {
+	var l Log
+
+	url, err := g.queryUrl(project, operator)
+	if err != nil {
+		return l, err
+	}
+
+	if size > 0 {
+		url += "&" + urlSize + strconv.Itoa(size)
+	}
+
+	if err := g.decode(url, &l); err != nil {
+		return l, err
+	}
+
+	return l, nil
+}
+
+// Tag returns the tag of operator, which is tag:TAG for a tag either
+// annotated or lightweight, or commit:ID for a tag object.
+func (g Gitiles) Tag(project, operator string) (Tag, error) {
+	var t Tag
+
+	if strings.HasPrefix(operator, opBranch) {
+		return t, errors.New("operator invalid")
+	}
+
+	url, err := g.getUrl(project, operator)
+	if err != nil {
+		return t, err
+	}
+
+	if err := g.decode(url, &t); err != nil {
+		return t, err
+	}
+
+	if t.Object == "" && t.Commit == "" {
+		return t, errors.New("tag invalid")
+	}
+
+	return t, nil
+}
+
+// Refs returns the refs of project under prefix, such as refs/heads or
+// refs/tags, where all refs are returned if prefix is empty or refs.
+//
+// Example:
+//
+// https://android.googlesource.com/platform/build/soong/+refs/tags?format=JSON
+//
+// nolint: lll
+func (g Gitiles) Refs(project, prefix string) (RefMap, error) {
+	var buf RefMap
+
+	if project == "" {
+		return nil, errors.New("parameter invalid")
+	}
+
+	url := g.url + "/" + project + urlRefs
+	if prefix = strings.Trim(strings.TrimPrefix(strings.Trim(prefix, "/"), "refs"), "/"); prefix != "" {
+		url += "/" + prefix
+	}
+
+	if err := g.decode(url+"?"+urlFormat, &buf); err != nil {
 		return nil, err
 	}
 
 	return buf, nil
 }
 
-func (g Gitiles) request(url, user, pass string) (map[string]interface{}, error) {
-	var buf map[string]interface{}
+// Tree returns the directory path of project at revision, which is a branch,
+// tag or commit.
+//
+// Example:
+//
+// https://android.googlesource.com/platform/build/soong/+/refs/heads/main/ui?format=JSON
+//
+// nolint: lll
+func (g Gitiles) Tree(project, revision, path string) (Tree, error) {
+	var t Tree
 
-	req, err := http.NewRequest(http.MethodGet, url, http.NoBody)
+	if project == "" || revision == "" {
+		return t, errors.New("parameter invalid")
+	}
+
+	url := g.url + "/" + project + urlConcat + revision + "/" + strings.Trim(path, "/") + "?" + urlFormat
+
+	if err := g.decode(url, &t); err != nil {
+		return t, err
+	}
+
+	return t, nil
+}
+
+// File returns the content of file name in project at revision, which is a
+// branch, tag or commit.
+//
+// Example:
+//
+// https://android.googlesource.com/platform/manifest/+/refs/heads/main/default.xml?format=TEXT
+//
+// nolint: lll
+func (g Gitiles) File(project, revision, name string) ([]byte, error) {
+	if project == "" || revision == "" || name == "" {
+		return nil, errors.New("parameter invalid")
+	}
+
+	body, err := g.fetch(g.url+"/"+project+urlConcat+revision+"/"+strings.TrimPrefix(name, "/")+"?"+urlText, g.user, g.pass)
 	if err != nil {
-		return nil, errors.Wrap(err, "request failed")
+		return nil, err
 	}
 
-	if user != "" && pass != "" {
-		req.SetBasicAuth(user, pass)
+	buf, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(body)))
+	if err != nil {
+		return nil, errors.Wrap(err, "decode failed")
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	return buf, nil
+}
+
+// Archive returns the gzipped tarball of project at revision, which is a
+// branch, tag or commit, and needs to be closed once read.
+//
+// Example:
+//
+// https://android.googlesource.com/platform/build/soong/+archive/refs/heads/main.tar.gz
+//
+// nolint: lll
+func (g Gitiles) Archive(project, revision string) (io.ReadCloser, error) {
+	if project == "" || revision == "" {
+		return nil, errors.New("parameter invalid")
+	}
+
+	return g.open(g.url+"/"+project+urlArchive+revision+urlTarGz, g.user, g.pass)
+}
+
+// decode requests url and decodes the JSON response into v.
+func (g Gitiles) decode(url string, v interface{}) error {
+	body, err := g.fetch(url, g.user, g.pass)
 	if err != nil {
-		return nil, errors.Wrap(err, "client failed")
+		return err
+	}
+
+	body = []byte(strings.TrimPrefix(strings.TrimSpace(string(body)), ")]}'"))
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return errors.Wrap(err, "unmarshal failed")
+	}
+
+	return nil
+}
+
+func (g Gitiles) fetch(url, user, pass string) ([]byte, error) {
+	rc, err := g.open(url, user, pass)
+	if err != nil {
+		return nil, err
 	}
 
 	defer func() {
-		_ = resp.Body.Close()
+		_ = rc.Close()
 	}()
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, errors.New("client failed")
+	body, err := io.ReadAll(rc)
+	if err != nil {
+		return nil, errors.New("read failed")
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	return body, nil
+}
+
+func (g Gitiles) open(url, user, pass string) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, url, http.NoBody)
 	if err != nil {
-		return nil, errors.New("read failed")
+		return nil, errors.Wrap(err, "request failed")
+	}
+
+	if user != "" && pass != "" {
+		req.SetBasicAuth(user, pass)
 	}
 
-	body = []byte(strings.ReplaceAll(string(body), ")]}'", ""))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "client failed")
+	}
 
-	if err := json.Unmarshal(body, &buf); err != nil {
-		return nil, errors.New("unmarshal failed")
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, errors.New("client failed")
 	}
 
-	return buf, nil
+	return resp.Body, nil
 }
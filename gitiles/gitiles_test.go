@@ -13,6 +13,10 @@
 package gitiles
 
 import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -60,9 +64,250 @@ func TestQuery(t *testing.T) {
 	assert.Equal(t, nil, err)
 }
 
-func TestRequest(t *testing.T) {
+func TestDecode(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/prefix":
+			_, _ = w.Write([]byte(")]}'\n{\"commit\":\"c1\"}\n"))
+		case "/plain":
+			_, _ = w.Write([]byte(`{"commit":"c2"}`))
+		case "/invalid":
+			_, _ = w.Write([]byte(")]}'\n{"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+
+	g := Gitiles{}
+
+	err := g.Init(s.URL, "", "")
+	assert.Equal(t, nil, err)
+
+	c := Commit{}
+
+	err = g.decode(s.URL+"/prefix", &c)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "c1", c.Commit)
+
+	err = g.decode(s.URL+"/plain", &c)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "c2", c.Commit)
+
+	err = g.decode(s.URL+"/invalid", &c)
+	assert.NotEqual(t, nil, err)
+
+	err = g.decode(s.URL+"/none", &c)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestFile(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/platform/manifest/+/refs/heads/master/default.xml" && r.URL.Query().Get("format") == "TEXT":
+			_, _ = w.Write([]byte(base64.StdEncoding.EncodeToString([]byte("<manifest/>"))))
+		case r.URL.Path == "/platform/manifest/+/master/invalid.xml":
+			_, _ = w.Write([]byte("<manifest/>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer s.Close()
+
+	g := Gitiles{}
+
+	err := g.Init(s.URL, "", "")
+	assert.Equal(t, nil, err)
+
+	buf, err := g.File("platform/manifest", "refs/heads/master", "/default.xml")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "<manifest/>", string(buf))
+
+	_, err = g.File("platform/manifest", "master", "invalid.xml")
+	assert.NotEqual(t, nil, err)
+
+	_, err = g.File("platform/manifest", "master", "none.xml")
+	assert.NotEqual(t, nil, err)
+
+	_, err = g.File("platform/manifest", "", "default.xml")
+	assert.NotEqual(t, nil, err)
+}
+
+func newServer() *httptest.Server {
+	pages := map[string]string{
+		"/platform/build/+/refs/heads/master": `{"commit":"c2","parents":["c1"],` +
+			`"committer":{"name":"Bob","time":"Sat Jun 27 08:09:10 2020 +0000"}}`,
+		"/platform/build/+/refs/heads/invalid":   `{"log":[]}`,
+		"/platform/build/+log/refs/heads/master": `{"log":[{"commit":"c2"},{"commit":"c1"}],"next":"c0"}`,
+		"/platform/build/+/refs/tags/v1":         `{"tag":"v1","object":"c1","type":"commit","tagger":{"name":"Alice"}}`,
+		"/platform/build/+/refs/tags/v2":         `{"commit":"c2"}`,
+		"/platform/build/+/refs/tags/none":       `{}`,
+		"/platform/build/+/t1":                   `{"tag":"v3","object":"c1","type":"commit"}`,
+		"/platform/build/+refs":                  `{"HEAD":{"value":"c2","target":"refs/heads/master"}}`,
+		"/platform/build/+refs/tags":             `{"v1":{"value":"t1","peeled":"c1"},"v2":{"value":"c2"}}`,
+		"/platform/build/+/master/":              `{"id":"t0","entries":[{"mode":16384,"type":"tree","id":"t1","name":"core"}]}`,
+		"/platform/build/+/master/core":          `{"id":"t1","entries":[{"mode":33188,"type":"blob","id":"b1","name":"Makefile"}]}`,
+		"/platform/build/+/master/broken":        `{"id":`,
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, ok := pages[r.URL.Path]
+		if !ok || r.URL.Query().Get("format") != "JSON" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(")]}'\n" + buf))
+	}))
+}
+
+func TestCommit(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+
+	g := Gitiles{}
+
+	err := g.Init(s.URL, "", "")
+	assert.Equal(t, nil, err)
+
+	c, err := g.Commit("platform/build", "branch:master")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "c2", c.Commit)
+	assert.Equal(t, []string{"c1"}, c.Parents)
+	assert.Equal(t, 2020, c.Committer.Time.Year())
+
+	_, err = g.Commit("platform/build", "branch:invalid")
+	assert.NotEqual(t, nil, err)
+
+	_, err = g.Commit("platform/build", "branch:none")
+	assert.NotEqual(t, nil, err)
+
+	_, err = g.Commit("platform/build", "invalid")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestLog(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+
+	g := Gitiles{}
+
+	err := g.Init(s.URL, "", "")
+	assert.Equal(t, nil, err)
+
+	l, err := g.Log("platform/build", "branch:master")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(l.Log))
+	assert.Equal(t, "c2", l.Log[0].Commit)
+	assert.Equal(t, "c0", l.Next)
+
+	_, err = g.Log("platform/build", "commit:c1")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestTag(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+
+	g := Gitiles{}
+
+	err := g.Init(s.URL, "", "")
+	assert.Equal(t, nil, err)
+
+	tag, err := g.Tag("platform/build", "tag:v1")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "c1", tag.Object)
+	assert.Equal(t, "commit", tag.Type)
+	assert.Equal(t, "Alice", tag.Tagger.Name)
+
+	tag, err = g.Tag("platform/build", "tag:v2")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "c2", tag.Commit)
+
+	tag, err = g.Tag("platform/build", "commit:t1")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "v3", tag.Tag)
+
+	_, err = g.Tag("platform/build", "tag:none")
+	assert.NotEqual(t, nil, err)
+
+	_, err = g.Tag("platform/build", "branch:master")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestRefs(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+
+	g := Gitiles{}
+
+	err := g.Init(s.URL, "", "")
+	assert.Equal(t, nil, err)
+
+	refs, err := g.Refs("platform/build", "refs/tags/")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, RefMap{"v1": {Value: "t1", Peeled: "c1"}, "v2": {Value: "c2"}}, refs)
+
+	refs, err = g.Refs("platform/build", "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "refs/heads/master", refs["HEAD"].Target)
+
+	_, err = g.Refs("platform/build", "refs/heads")
+	assert.NotEqual(t, nil, err)
+
+	_, err = g.Refs("", "refs/tags")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestTree(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+
 	g := Gitiles{}
 
-	_, err := g.request("https://android.googlesource.com/platform/build/soong/+/refs/heads/master?format=JSON", "", "")
+	err := g.Init(s.URL, "", "")
+	assert.Equal(t, nil, err)
+
+	tree, err := g.Tree("platform/build", "master", "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []TreeEntry{{Mode: 16384, Type: "tree", Id: "t1", Name: "core"}}, tree.Entries)
+
+	tree, err = g.Tree("platform/build", "master", "/core/")
 	assert.Equal(t, nil, err)
+	assert.Equal(t, "Makefile", tree.Entries[0].Name)
+
+	_, err = g.Tree("platform/build", "master", "broken")
+	assert.NotEqual(t, nil, err)
+
+	_, err = g.Tree("platform/build", "", "core")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestArchive(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/platform/build/+archive/refs/heads/master.tar.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("archive"))
+	}))
+	defer s.Close()
+
+	g := Gitiles{}
+
+	err := g.Init(s.URL, "", "")
+	assert.Equal(t, nil, err)
+
+	rc, err := g.Archive("platform/build", "refs/heads/master")
+	assert.Equal(t, nil, err)
+
+	buf, err := io.ReadAll(rc)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "archive", string(buf))
+	assert.Equal(t, nil, rc.Close())
+
+	_, err = g.Archive("platform/build", "main")
+	assert.NotEqual(t, nil, err)
+
+	_, err = g.Archive("platform/build", "")
+	assert.NotEqual(t, nil, err)
 }
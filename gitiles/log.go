@@ -0,0 +1,85 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitiles
+
+import (
+	"github.com/pkg/errors"
+)
+
+// ErrMaxPages is returned by LogIterator once the log goes on past max pages.
+var ErrMaxPages = errors.New("max pages exceeded")
+
+// LogIterator iterates over a log page by page, following the next cursor of
+// every page. Call Next until it returns false, then check Err.
+type LogIterator struct {
+	g        Gitiles
+	project  string
+	operator string
+	start    string
+	size     int
+	max      int
+
+	commit Commit
+	done   bool
+	err    error
+	next   string
+	page   []Commit
+	pages  int
+}
+
+// Next advances to the next commit, requesting the next page if needed, and
+// returns false once the log ends or fails.
+func (i *LogIterator) Next() bool {
+	for len(i.page) == 0 {
+		if i.done || i.err != nil {
+			return false
+		}
+		if i.max > 0 && i.pages >= i.max {
+			i.err = ErrMaxPages
+			return false
+		}
+		operator := i.start
+		if i.pages > 0 {
+			operator = i.operator + opDelimiter + opCommit + i.next
+		}
+		l, err := i.g.logPage(i.project, operator, i.size)
+		if err != nil {
+			i.err = errors.Wrap(err, "log failed")
+			return false
+		}
+		i.pages++
+		i.page = l.Log
+		i.next = l.Next
+		i.done = l.Next == ""
+	}
+
+	i.commit, i.page = i.page[0], i.page[1:]
+
+	return true
+}
+
+// Commit returns the current commit.
+func (i *LogIterator) Commit() Commit {
+	return i.commit
+}
+
+// Err returns the error the iterator stopped with, which is nil if the log
+// ended.
+func (i *LogIterator) Err() error {
+	return i.err
+}
+
+// Pages returns the number of pages requested so far.
+func (i *LogIterator) Pages() int {
+	return i.pages
+}
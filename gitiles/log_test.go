@@ -0,0 +1,118 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitiles
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+// newLogServer serves a log of total commits c0 to c<total-1>, in pages of n
+// commits, or 100 if n is not given, starting from the commit s.
+func newLogServer(total int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/platform/build/+log/refs/heads/master" && r.URL.Path != "/platform/build/+log/refs/heads/master/" {
+			http.NotFound(w, r)
+			return
+		}
+		start := 0
+		if s := r.URL.Query().Get("s"); s != "" {
+			start, _ = strconv.Atoi(s[1:])
+		}
+		size := 100
+		if n := r.URL.Query().Get("n"); n != "" {
+			size, _ = strconv.Atoi(n)
+		}
+		l := Log{}
+		for i := start; i < total && i < start+size; i++ {
+			l.Log = append(l.Log, Commit{Commit: "c" + strconv.Itoa(i)})
+		}
+		if start+size < total {
+			l.Next = "c" + strconv.Itoa(start+size)
+		}
+		buf, _ := json.Marshal(l)
+		_, _ = w.Write(append([]byte(")]}'\n"), buf...))
+	}))
+}
+
+func TestLogs(t *testing.T) {
+	s := newLogServer(250)
+	defer s.Close()
+
+	g := Gitiles{}
+
+	err := g.Init(s.URL, "", "")
+	assert.Equal(t, nil, err)
+
+	var buf []string
+
+	i := g.Logs("platform/build", "branch:master", 0, 0)
+	for i.Next() {
+		buf = append(buf, i.Commit().Commit)
+	}
+
+	assert.Equal(t, nil, i.Err())
+	assert.Equal(t, 3, i.Pages())
+	assert.Equal(t, 250, len(buf))
+	assert.Equal(t, "c0", buf[0])
+	assert.Equal(t, "c249", buf[249])
+
+	count := 0
+
+	i = g.Logs("platform/build", "branch:master commit:c200", 20, 0)
+	for i.Next() {
+		count++
+	}
+
+	assert.Equal(t, nil, i.Err())
+	assert.Equal(t, 3, i.Pages())
+	assert.Equal(t, 50, count)
+
+	count = 0
+
+	i = g.Logs("platform/build", "branch:master", 50, 2)
+	for i.Next() {
+		count++
+	}
+
+	assert.Equal(t, ErrMaxPages, errors.Cause(i.Err()))
+	assert.Equal(t, 100, count)
+	assert.Equal(t, false, i.Next())
+
+	count = 0
+
+	i = g.Logs("platform/build", "branch:master", 50, 5)
+	for i.Next() {
+		count++
+	}
+
+	assert.Equal(t, nil, i.Err())
+	assert.Equal(t, 5, i.Pages())
+	assert.Equal(t, 250, count)
+
+	i = g.Logs("platform/build", "branch:invalid", 0, 0)
+
+	assert.Equal(t, false, i.Next())
+	assert.NotEqual(t, nil, i.Err())
+
+	i = g.Logs("platform/build", "commit:c1", 0, 0)
+
+	assert.Equal(t, false, i.Next())
+	assert.NotEqual(t, nil, i.Err())
+}
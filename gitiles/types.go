@@ -0,0 +1,131 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitiles
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	TimeFormat = "Mon Jan 2 15:04:05 2006 -0700"
+)
+
+// Person is the author, committer or tagger of an object.
+type Person struct {
+	Name  string    `json:"name"`
+	Email string    `json:"email"`
+	Time  time.Time `json:"-"`
+}
+
+// Commit is a commit, where TreeDiff is only returned in logs queried with
+// name-status.
+type Commit struct {
+	Commit    string     `json:"commit"`
+	Tree      string     `json:"tree"`
+	Parents   []string   `json:"parents"`
+	Author    Person     `json:"author"`
+	Committer Person     `json:"committer"`
+	Message   string     `json:"message"`
+	TreeDiff  []TreeDiff `json:"tree_diff,omitempty"`
+}
+
+// TreeDiff is a file changed by a commit.
+type TreeDiff struct {
+	Type    string `json:"type"`
+	OldId   string `json:"old_id"`
+	OldMode int    `json:"old_mode"`
+	OldPath string `json:"old_path"`
+	NewId   string `json:"new_id"`
+	NewMode int    `json:"new_mode"`
+	NewPath string `json:"new_path"`
+}
+
+// Log is a page of commits, where Next is the commit the next page starts
+// from, and is empty on the last page.
+type Log struct {
+	Log      []Commit `json:"log"`
+	Previous string   `json:"previous,omitempty"`
+	Next     string   `json:"next,omitempty"`
+}
+
+// Ref is a ref, where Peeled is the commit of an annotated tag, and Target is
+// the ref a symbolic ref points to.
+type Ref struct {
+	Value  string `json:"value"`
+	Peeled string `json:"peeled,omitempty"`
+	Target string `json:"target,omitempty"`
+}
+
+// RefMap maps ref names, relative to the prefix queried, to refs.
+type RefMap map[string]Ref
+
+// Tag is a tag. Object is the object an annotated tag points to, whose type
+// is Type. Gitiles returns the commit for a lightweight tag instead, whose ID
+// is in Commit.
+type Tag struct {
+	Tag     string `json:"tag"`
+	Object  string `json:"object"`
+	Type    string `json:"type"`
+	Tagger  Person `json:"tagger"`
+	Message string `json:"message"`
+	Commit  string `json:"commit"`
+}
+
+// Tree is a directory of a tree.
+type Tree struct {
+	Id      string      `json:"id"`
+	Entries []TreeEntry `json:"entries"`
+}
+
+// TreeEntry is a file in a tree, where Type is blob, tree or commit for
+// submodules.
+type TreeEntry struct {
+	Mode int    `json:"mode"`
+	Type string `json:"type"`
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// UnmarshalJSON decodes p, parsing the time in TimeFormat.
+func (p *Person) UnmarshalJSON(buf []byte) error {
+	type person Person
+
+	v := struct {
+		*person
+		Time string `json:"time"`
+	}{
+		person: (*person)(p),
+	}
+
+	if err := json.Unmarshal(buf, &v); err != nil {
+		return err
+	}
+
+	p.Time = time.Time{}
+
+	if v.Time == "" {
+		return nil
+	}
+
+	t, err := time.Parse(TimeFormat, v.Time)
+	if err != nil {
+		return errors.Wrap(err, "time invalid")
+	}
+
+	p.Time = t
+
+	return nil
+}
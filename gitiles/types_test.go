@@ -0,0 +1,72 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gitiles
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPerson(t *testing.T) {
+	p := Person{}
+
+	err := json.Unmarshal([]byte(`{"name":"Alice","email":"alice@example.com","time":"Fri Jun 26 08:09:10 2020 +0800"}`), &p)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "Alice", p.Name)
+	assert.Equal(t, "alice@example.com", p.Email)
+	assert.Equal(t, time.Date(2020, 6, 26, 0, 9, 10, 0, time.UTC), p.Time.UTC())
+
+	p = Person{}
+
+	err = json.Unmarshal([]byte(`{"name":"Alice","time":"Thu Jul 2 08:09:10 2020 +0000"}`), &p)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "", p.Email)
+	assert.Equal(t, time.Date(2020, 7, 2, 8, 9, 10, 0, time.UTC), p.Time.UTC())
+
+	err = json.Unmarshal([]byte(`{"name":"Alice"}`), &p)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, p.Time.IsZero())
+
+	err = json.Unmarshal([]byte(`{"name":"Alice","time":"2020-06-26T08:09:10Z"}`), &p)
+	assert.NotEqual(t, nil, err)
+
+	err = json.Unmarshal([]byte(`{"name":"Alice","time":42}`), &p)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestCommitType(t *testing.T) {
+	c := Commit{}
+
+	err := json.Unmarshal([]byte(`{
+		"commit": "c1",
+		"tree": "t1",
+		"parents": ["c0"],
+		"author": {"name": "Alice", "email": "alice@example.com", "time": "Fri Jun 26 08:09:10 2020 +0000"},
+		"committer": {"name": "Bob", "email": "bob@example.com", "time": "Sat Jun 27 08:09:10 2020 +0000"},
+		"message": "Init\n",
+		"tree_diff": [{"type": "add", "new_id": "b1", "new_mode": 33188, "new_path": "README"}]
+	}`), &c)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "c1", c.Commit)
+	assert.Equal(t, []string{"c0"}, c.Parents)
+	assert.Equal(t, "Bob", c.Committer.Name)
+	assert.Equal(t, true, c.Committer.Time.After(c.Author.Time))
+	assert.Equal(t, 1, len(c.TreeDiff))
+	assert.Equal(t, "README", c.TreeDiff[0].NewPath)
+
+	err = json.Unmarshal([]byte(`{"commit": "c1", "committer": {"time": "invalid"}}`), &c)
+	assert.NotEqual(t, nil, err)
+}
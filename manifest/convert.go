@@ -0,0 +1,129 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+var emptyPattern = regexp.MustCompile(`<([\w-]+)([^<>]*)></([\w-]+)>`)
+
+const (
+	FormatJson = "json"
+	FormatXml  = "xml"
+	FormatYaml = "yaml"
+)
+
+// Format returns the format of manifest name by its extension, which is XML
+// for unknown extensions.
+func Format(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		return FormatJson
+	case ".yaml", ".yml":
+		return FormatYaml
+	}
+
+	return FormatXml
+}
+
+// Read reads the manifest in name in the format of its extension as is,
+// without expanding includes or applying local manifests.
+func (m *Manifest) Read(name string) error {
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		return errors.Wrap(err, "read failed")
+	}
+
+	if err := m.Decode(buf, Format(name)); err != nil {
+		return errors.Wrap(err, "decode failed")
+	}
+
+	return nil
+}
+
+// Decode reads the manifest in buf of format, where unknown fields are
+// rejected for JSON and YAML.
+func (m *Manifest) Decode(buf []byte, format string) error {
+	n := Manifest{}
+
+	switch format {
+	case FormatJson:
+		d := json.NewDecoder(bytes.NewReader(buf))
+		d.DisallowUnknownFields()
+		if err := d.Decode(&n); err != nil {
+			return errors.Wrap(err, "json invalid")
+		}
+	case FormatXml:
+		if err := xml.Unmarshal(buf, &n); err != nil {
+			return errors.Wrap(err, "xml invalid")
+		}
+	case FormatYaml:
+		if err := yaml.UnmarshalStrict(buf, &n); err != nil {
+			return errors.Wrap(err, "yaml invalid")
+		}
+	default:
+		return errors.New("format invalid")
+	}
+
+	*m = n
+
+	return nil
+}
+
+// Encode returns the manifest in format.
+func (m Manifest) Encode(format string) ([]byte, error) {
+	var buf []byte
+	var err error
+
+	switch format {
+	case FormatJson:
+		buf, err = json.MarshalIndent(m, "", indent)
+	case FormatXml:
+		if buf, err = xml.MarshalIndent(m, "", indent); err == nil {
+			buf = append([]byte(xml.Header), selfClose(buf)...)
+		}
+	case FormatYaml:
+		if buf, err = yaml.Marshal(m); err == nil {
+			return buf, nil
+		}
+	default:
+		return nil, errors.New("format invalid")
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "marshal failed")
+	}
+
+	return append(buf, '\n'), nil
+}
+
+// selfClose rewrites empty elements in buf to self-closing tags like repo does.
+func selfClose(buf []byte) []byte {
+	return emptyPattern.ReplaceAllFunc(buf, func(b []byte) []byte {
+		match := emptyPattern.FindSubmatch(b)
+		if string(match[1]) != string(match[3]) {
+			return b
+		}
+		return []byte("<" + string(match[1]) + string(match[2]) + "/>")
+	})
+}
@@ -0,0 +1,113 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, FormatJson, Format("default.JSON"))
+	assert.Equal(t, FormatYaml, Format("default.yaml"))
+	assert.Equal(t, FormatYaml, Format("default.yml"))
+	assert.Equal(t, FormatXml, Format("default.xml"))
+	assert.Equal(t, FormatXml, Format("manifest"))
+}
+
+func TestConvert(t *testing.T) {
+	m := Manifest{}
+
+	err := m.Read("../test/manifest-1.xml")
+	assert.Equal(t, nil, err)
+
+	for _, format := range []string{FormatJson, FormatXml, FormatYaml} {
+		buf, err := m.Encode(format)
+		assert.Equal(t, nil, err)
+
+		n := Manifest{}
+		err = n.Decode(buf, format)
+		assert.Equal(t, nil, err)
+
+		a, _ := m.Encode(FormatXml)
+		b, _ := n.Encode(FormatXml)
+		assert.Equal(t, string(a), string(b))
+	}
+
+	buf, err := m.Encode(FormatJson)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, strings.Contains(string(buf), `"clone-depth": "100"`))
+	assert.Equal(t, true, strings.Contains(string(buf), `"remotes": [`))
+
+	buf, err = m.Encode(FormatYaml)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, strings.Contains(string(buf), "clone-depth: \"100\""))
+
+	_, err = m.Encode("toml")
+	assert.NotEqual(t, nil, err)
+
+	err = m.Decode([]byte(`{"projects":[{"name":"a","unknown":"b"}]}`), FormatJson)
+	assert.NotEqual(t, nil, err)
+
+	err = m.Decode([]byte("projects:\n- name: a\n  unknown: b\n"), FormatYaml)
+	assert.NotEqual(t, nil, err)
+
+	err = m.Decode([]byte("<manifest><project"), FormatXml)
+	assert.NotEqual(t, nil, err)
+
+	err = m.Decode(nil, "toml")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestConvertYaml(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFiles(t, dir, map[string]string{
+		"overlay.yaml": `remotes:
+- name: aosp
+  fetch: ..
+default:
+  remote: aosp
+  revision: master
+projects:
+- name: platform/art
+  path: art
+  groups: pdk
+  copyfiles:
+  - src: a
+    dest: b
+`,
+	})
+
+	m := Manifest{}
+
+	err := m.Read(filepath.Join(dir, "overlay.yaml"))
+	assert.Equal(t, nil, err)
+
+	err = m.Write(filepath.Join(dir, "overlay.xml"))
+	assert.Equal(t, nil, err)
+
+	n := Manifest{}
+
+	err = n.Load(filepath.Join(dir, "overlay.xml"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "aosp", n.Remotes[0].Name)
+	assert.Equal(t, "art", n.Projects[0].Path)
+	assert.Equal(t, "b", n.Projects[0].CopyFiles[0].Dest)
+
+	err = m.Read(filepath.Join(dir, "none.yaml"))
+	assert.NotEqual(t, nil, err)
+}
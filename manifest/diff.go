@@ -0,0 +1,294 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Diff holds the changes from a manifest to another one. Projects are
+// identified by name, and the ones with the same name by path.
+type Diff struct {
+	Added   []Change `json:"added"`
+	Removed []Change `json:"removed"`
+	Moved   []Change `json:"moved"`
+	Revised []Change `json:"revised"`
+	Remotes []Change `json:"remotes"`
+	Default *Change  `json:"default,omitempty"`
+}
+
+// Change is a change of an element, where Old and New are paths for moved
+// projects, revisions for the other projects, and attributes for remotes and default.
+type Change struct {
+	Name string `json:"name"`
+	Path string `json:"path,omitempty"`
+	Old  string `json:"old,omitempty"`
+	New  string `json:"new,omitempty"`
+}
+
+// Compare returns the changes from m to n.
+func Compare(m, n *Manifest) Diff {
+	d := Diff{
+		Added:   []Change{},
+		Removed: []Change{},
+		Moved:   []Change{},
+		Revised: []Change{},
+		Remotes: []Change{},
+	}
+
+	d.compareProjects(m, n)
+	d.compareRemotes(m, n)
+
+	var a, b string
+
+	if m.Default != nil {
+		a = attrs(*m.Default)
+	}
+
+	if n.Default != nil {
+		b = attrs(*n.Default)
+	}
+
+	if a != b {
+		d.Default = &Change{Name: "default", Old: a, New: b}
+	}
+
+	return d
+}
+
+// nolint: gocyclo
+func (d *Diff) compareProjects(m, n *Manifest) {
+	var names []string
+
+	olds := map[string][]Project{}
+	news := map[string][]Project{}
+
+	for _, val := range m.Projects {
+		if _, ok := olds[val.Name]; !ok {
+			names = append(names, val.Name)
+		}
+		olds[val.Name] = append(olds[val.Name], val)
+	}
+
+	for _, val := range n.Projects {
+		if _, ok := olds[val.Name]; !ok {
+			if _, ok := news[val.Name]; !ok {
+				names = append(names, val.Name)
+			}
+		}
+		news[val.Name] = append(news[val.Name], val)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		a, b := pairProjects(olds[name], news[name])
+		for index := range a {
+			switch {
+			case a[index] == nil:
+				rev, _ := n.Revision(*b[index])
+				d.Added = append(d.Added, Change{Name: name, Path: b[index].RelPath(), New: rev})
+			case b[index] == nil:
+				rev, _ := m.Revision(*a[index])
+				d.Removed = append(d.Removed, Change{Name: name, Path: a[index].RelPath(), Old: rev})
+			default:
+				if a[index].RelPath() != b[index].RelPath() {
+					d.Moved = append(d.Moved, Change{Name: name, Path: b[index].RelPath(),
+						Old: a[index].RelPath(), New: b[index].RelPath()})
+				}
+				old, _ := m.Revision(*a[index])
+				rev, _ := n.Revision(*b[index])
+				if old != rev {
+					d.Revised = append(d.Revised, Change{Name: name, Path: b[index].RelPath(), Old: old, New: rev})
+				}
+			}
+		}
+	}
+}
+
+// pairProjects pairs projects of the same name by path first, then in order,
+// where nil stands for the project missing on either side.
+func pairProjects(olds, news []Project) (a, b []*Project) {
+	used := make([]bool, len(news))
+
+	var rest []*Project
+
+	for i := range olds {
+		matched := false
+		for j := range news {
+			if !used[j] && olds[i].RelPath() == news[j].RelPath() {
+				a, b = append(a, &olds[i]), append(b, &news[j])
+				used[j], matched = true, true
+				break
+			}
+		}
+		if !matched {
+			rest = append(rest, &olds[i])
+		}
+	}
+
+	for j := range news {
+		if used[j] {
+			continue
+		}
+		var p *Project
+		if len(rest) != 0 {
+			p, rest = rest[0], rest[1:]
+		}
+		a, b = append(a, p), append(b, &news[j])
+	}
+
+	for _, val := range rest {
+		a, b = append(a, val), append(b, nil)
+	}
+
+	return a, b
+}
+
+func (d *Diff) compareRemotes(m, n *Manifest) {
+	olds := map[string]string{}
+	news := map[string]string{}
+
+	var names []string
+
+	for _, val := range m.Remotes {
+		olds[val.Name] = attrs(val)
+		names = append(names, val.Name)
+	}
+
+	for _, val := range n.Remotes {
+		news[val.Name] = attrs(val)
+		if _, ok := olds[val.Name]; !ok {
+			names = append(names, val.Name)
+		}
+	}
+
+	sort.Strings(names)
+
+	for _, val := range names {
+		if olds[val] != news[val] {
+			d.Remotes = append(d.Remotes, Change{Name: val, Old: olds[val], New: news[val]})
+		}
+	}
+}
+
+// Empty returns true if there is no change at all.
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Moved) == 0 &&
+		len(d.Revised) == 0 && len(d.Remotes) == 0 && d.Default == nil
+}
+
+func (d Diff) Text() string {
+	var buf strings.Builder
+
+	for _, val := range d.Added {
+		fmt.Fprintf(&buf, "A %s %s %s\n", val.Name, val.Path, val.New)
+	}
+
+	for _, val := range d.Removed {
+		fmt.Fprintf(&buf, "D %s %s %s\n", val.Name, val.Path, val.Old)
+	}
+
+	for _, val := range d.Moved {
+		fmt.Fprintf(&buf, "R %s %s -> %s\n", val.Name, val.Old, val.New)
+	}
+
+	for _, val := range d.Revised {
+		fmt.Fprintf(&buf, "M %s %s %s -> %s\n", val.Name, val.Path, val.Old, val.New)
+	}
+
+	for _, val := range d.Remotes {
+		fmt.Fprintf(&buf, "remote %s: %s -> %s\n", val.Name, OrNone(val.Old), OrNone(val.New))
+	}
+
+	if d.Default != nil {
+		fmt.Fprintf(&buf, "default: %s -> %s\n", OrNone(d.Default.Old), OrNone(d.Default.New))
+	}
+
+	return buf.String()
+}
+
+func (d Diff) Markdown() string {
+	var buf strings.Builder
+
+	table := func(title, header string, changes []Change, row func(Change) string) {
+		if len(changes) == 0 {
+			return
+		}
+		fmt.Fprintf(&buf, "## %s\n\n%s\n", title, header)
+		fmt.Fprintf(&buf, "|%s\n", strings.Repeat(" --- |", strings.Count(header, "|")-1))
+		for _, val := range changes {
+			fmt.Fprintf(&buf, "%s\n", row(val))
+		}
+		buf.WriteString("\n")
+	}
+
+	table("Added", "| Name | Path | Revision |", d.Added, func(c Change) string {
+		return fmt.Sprintf("| %s | %s | %s |", c.Name, c.Path, c.New)
+	})
+
+	table("Removed", "| Name | Path | Revision |", d.Removed, func(c Change) string {
+		return fmt.Sprintf("| %s | %s | %s |", c.Name, c.Path, c.Old)
+	})
+
+	table("Moved", "| Name | Old Path | New Path |", d.Moved, func(c Change) string {
+		return fmt.Sprintf("| %s | %s | %s |", c.Name, c.Old, c.New)
+	})
+
+	table("Revised", "| Name | Path | Old Revision | New Revision |", d.Revised, func(c Change) string {
+		return fmt.Sprintf("| %s | %s | %s | %s |", c.Name, c.Path, c.Old, c.New)
+	})
+
+	table("Remotes", "| Name | Old | New |", d.Remotes, func(c Change) string {
+		return fmt.Sprintf("| %s | `%s` | `%s` |", c.Name, OrNone(c.Old), OrNone(c.New))
+	})
+
+	if d.Default != nil {
+		table("Default", "| Old | New |", []Change{*d.Default}, func(c Change) string {
+			return fmt.Sprintf("| `%s` | `%s` |", OrNone(c.Old), OrNone(c.New))
+		})
+	}
+
+	return buf.String()
+}
+
+// attrs returns the non-empty XML attributes of element v in the form of key="value".
+func attrs(v interface{}) string {
+	var buf []string
+
+	value := reflect.ValueOf(v)
+
+	for i := 0; i < value.NumField(); i++ {
+		tag := strings.Split(value.Type().Field(i).Tag.Get("xml"), ",")
+		if len(tag) < 2 || tag[1] != "attr" || value.Field(i).Kind() != reflect.String {
+			continue
+		}
+		if s := value.Field(i).String(); s != "" {
+			buf = append(buf, fmt.Sprintf("%s=%q", tag[0], s))
+		}
+	}
+
+	return strings.Join(buf, " ")
+}
+
+// OrNone returns s, or (none) if s is empty, for printing values unset.
+func OrNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+
+	return s
+}
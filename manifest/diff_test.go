@@ -0,0 +1,105 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func loadDiff(t *testing.T) Diff {
+	dir := t.TempDir()
+
+	writeFiles(t, dir, map[string]string{
+		"a.xml": `<manifest>
+  <remote fetch=".." name="aosp"/>
+  <remote fetch="https://github.com" name="github"/>
+  <default remote="aosp" revision="master"/>
+  <project name="platform/build" path="build/make"/>
+  <project name="platform/art" path="art"/>
+  <project name="platform/bionic" path="bionic"/>
+  <project name="device/common" path="device/a"/>
+  <project name="device/common" path="device/b"/>
+</manifest>`,
+		"b.xml": `<manifest>
+  <remote fetch=".." name="aosp" review="https://android-review.googlesource.com/"/>
+  <default remote="aosp" revision="android10-release"/>
+  <project name="platform/build" path="build/make" revision="master"/>
+  <project name="platform/art" path="platform/art"/>
+  <project name="platform/soong" path="build/soong"/>
+  <project name="device/common" path="device/b"/>
+</manifest>`,
+	})
+
+	a, b := Manifest{}, Manifest{}
+
+	err := a.Load(filepath.Join(dir, "a.xml"))
+	assert.Equal(t, nil, err)
+
+	err = b.Load(filepath.Join(dir, "b.xml"))
+	assert.Equal(t, nil, err)
+
+	return Compare(&a, &b)
+}
+
+func TestCompare(t *testing.T) {
+	d := loadDiff(t)
+
+	assert.Equal(t, []Change{{Name: "platform/soong", Path: "build/soong", New: "android10-release"}}, d.Added)
+	assert.Equal(t, []Change{
+		{Name: "device/common", Path: "device/a", Old: "master"},
+		{Name: "platform/bionic", Path: "bionic", Old: "master"},
+	}, d.Removed)
+	assert.Equal(t, []Change{{Name: "platform/art", Path: "platform/art", Old: "art", New: "platform/art"}}, d.Moved)
+	assert.Equal(t, []Change{
+		{Name: "device/common", Path: "device/b", Old: "master", New: "android10-release"},
+		{Name: "platform/art", Path: "platform/art", Old: "master", New: "android10-release"},
+	}, d.Revised)
+	assert.Equal(t, 2, len(d.Remotes))
+	assert.Equal(t, `name="aosp" fetch=".." review="https://android-review.googlesource.com/"`, d.Remotes[0].New)
+	assert.Equal(t, "", d.Remotes[1].New)
+	assert.Equal(t, `remote="aosp" revision="android10-release"`, d.Default.New)
+	assert.Equal(t, false, d.Empty())
+
+	m := Manifest{}
+
+	err := m.Load("../test/manifest-1.xml")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, Compare(&m, &m).Empty())
+}
+
+func TestDiffText(t *testing.T) {
+	d := loadDiff(t)
+
+	buf := d.Text()
+	assert.Equal(t, true, strings.Contains(buf, "A platform/soong build/soong android10-release\n"))
+	assert.Equal(t, true, strings.Contains(buf, "R platform/art art -> platform/art\n"))
+	assert.Equal(t, true, strings.Contains(buf, "remote github: name=\"github\" fetch=\"https://github.com\" -> (none)\n"))
+}
+
+func TestDiffMarkdown(t *testing.T) {
+	d := loadDiff(t)
+
+	buf := d.Markdown()
+	assert.Equal(t, true, strings.Contains(buf, "## Added\n\n| Name | Path | Revision |\n| --- | --- | --- |\n"))
+	assert.Equal(t, true, strings.Contains(buf, "| platform/art | platform/art | master | android10-release |\n"))
+	assert.Equal(t, "", Diff{}.Markdown())
+}
+
+func TestOrNone(t *testing.T) {
+	assert.Equal(t, "(none)", OrNone(""))
+	assert.Equal(t, "master", OrNone("master"))
+}
@@ -0,0 +1,218 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+var attrPattern = regexp.MustCompile(`\s+([^\s=/>]+)\s*=\s*("[^"]*"|'[^']*')`)
+
+// Editor patches attributes of a manifest in place, keeping comments,
+// ordering and formatting of everything else untouched.
+type Editor struct {
+	buf []byte
+}
+
+// patch replaces buf[start:end] with text.
+type patch struct {
+	start int
+	end   int
+	text  []byte
+}
+
+// element is a start tag found in the manifest, with its byte range and attributes.
+type element struct {
+	name  string
+	start int
+	end   int
+	attrs map[string]string
+}
+
+// Edit reads the manifest in name for editing.
+func Edit(name string) (*Editor, error) {
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		return nil, errors.Wrap(err, "read failed")
+	}
+
+	return NewEditor(buf), nil
+}
+
+func NewEditor(buf []byte) *Editor {
+	return &Editor{buf: buf}
+}
+
+func (e *Editor) Bytes() []byte {
+	return e.buf
+}
+
+func (e *Editor) Write(name string) error {
+	if err := os.WriteFile(name, e.buf, perm); err != nil {
+		return errors.Wrap(err, "write failed")
+	}
+
+	return nil
+}
+
+// SetAttr sets attribute key to value for elements of tag which match returns
+// true for, and removes it if value is empty. The number of elements matched
+// is returned.
+func (e *Editor) SetAttr(tag string, match func(map[string]string) bool, key, value string) (int, error) {
+	elements, err := e.elements()
+	if err != nil {
+		return 0, errors.Wrap(err, "parse failed")
+	}
+
+	var patches []patch
+
+	for _, val := range elements {
+		if val.name != tag || !match(val.attrs) {
+			continue
+		}
+		patches = append(patches, e.setAttr(val, key, value))
+	}
+
+	e.apply(patches)
+
+	return len(patches), nil
+}
+
+// SetProjectAttr sets attribute key to value for the project of name and path,
+// where path defaults to name like RelPath does.
+func (e *Editor) SetProjectAttr(name, path, key, value string) (int, error) {
+	return e.SetAttr("project", func(attrs map[string]string) bool {
+		p := Project{Name: attrs["name"], Path: attrs["path"]}
+		return p.Name == name && p.RelPath() == path
+	}, key, value)
+}
+
+// SetProjectAttrAt sets attribute key to value for the project of name whose
+// start tag is at line like its Source, which also finds projects moved by
+// extend-project dest-path. Nothing is set if more than one project matches.
+func (e *Editor) SetProjectAttrAt(name string, line int, key, value string) (int, error) {
+	elements, err := e.elements()
+	if err != nil {
+		return 0, errors.Wrap(err, "parse failed")
+	}
+
+	var patches []patch
+
+	lines := newLineIndex(e.buf)
+
+	for _, val := range elements {
+		if val.name != "project" || val.attrs["name"] != name || lines.line(int64(val.start)) != line {
+			continue
+		}
+		patches = append(patches, e.setAttr(val, key, value))
+	}
+
+	if len(patches) > 1 {
+		return len(patches), errors.New("project " + name + " ambiguous")
+	}
+
+	e.apply(patches)
+
+	return len(patches), nil
+}
+
+func (e *Editor) elements() ([]element, error) {
+	var elements []element
+
+	d := xml.NewDecoder(bytes.NewReader(e.buf))
+
+	for {
+		start := int(d.InputOffset())
+		token, err := d.Token()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		if t, ok := token.(xml.StartElement); ok {
+			attrs := map[string]string{}
+			for _, val := range t.Attr {
+				attrs[val.Name.Local] = val.Value
+			}
+			elements = append(elements, element{
+				name:  t.Name.Local,
+				start: start,
+				end:   int(d.InputOffset()),
+				attrs: attrs,
+			})
+		}
+	}
+
+	return elements, nil
+}
+
+// setAttr returns the patch to set attribute key of element el, replacing the
+// value only if the attribute exists, or appending it after the last attribute.
+func (e *Editor) setAttr(el element, key, value string) patch {
+	tag := e.buf[el.start:el.end]
+
+	var buf bytes.Buffer
+	_ = xml.EscapeText(&buf, []byte(value))
+
+	for _, val := range attrPattern.FindAllSubmatchIndex(tag, -1) {
+		if string(tag[val[2]:val[3]]) != key {
+			continue
+		}
+		if value == "" {
+			return patch{start: el.start + val[0], end: el.start + val[1]}
+		}
+		quote := tag[val[4]]
+		return patch{
+			start: el.start + val[4],
+			end:   el.start + val[5],
+			text:  []byte(string(quote) + buf.String() + string(quote)),
+		}
+	}
+
+	if value == "" {
+		return patch{start: el.start, end: el.start, text: nil}
+	}
+
+	offset := len(el.name) + 1
+	if found := attrPattern.FindAllIndex(tag, -1); len(found) != 0 {
+		offset = found[len(found)-1][1]
+	}
+
+	return patch{
+		start: el.start + offset,
+		end:   el.start + offset,
+		text:  []byte(" " + key + `="` + buf.String() + `"`),
+	}
+}
+
+func (e *Editor) apply(patches []patch) {
+	sort.Slice(patches, func(i, j int) bool {
+		return patches[i].start > patches[j].start
+	})
+
+	for _, val := range patches {
+		var buf []byte
+		buf = append(buf, e.buf[:val.start]...)
+		buf = append(buf, val.text...)
+		buf = append(buf, e.buf[val.end:]...)
+		e.buf = buf
+	}
+}
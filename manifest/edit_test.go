@@ -0,0 +1,147 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	editManifest = `<?xml version="1.0" encoding="UTF-8"?>
+<manifest>
+  <!-- remotes first -->
+  <remote  name="aosp"
+           fetch=".." />
+  <default revision="master" remote="aosp"/>
+
+  <project path="build/make" name="platform/build" groups="pdk" />
+  <project name='platform/art' path='art' clone-depth='1'>
+    <copyfile src="a" dest="b"/>
+  </project>
+  <project name="platform/art" path="art2"></project>
+</manifest>
+`
+)
+
+func TestSetProjectAttr(t *testing.T) {
+	e := NewEditor([]byte(editManifest))
+
+	count, err := e.SetProjectAttr("platform/build", "build/make", "clone-depth", "2")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, count)
+
+	count, err = e.SetProjectAttr("platform/art", "art", "clone-depth", "a&b")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, count)
+
+	count, err = e.SetProjectAttr("platform/art", "art2", "revision", "dev")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, count)
+
+	count, err = e.SetProjectAttr("platform/none", "none", "revision", "dev")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, count)
+
+	assert.Equal(t, `<?xml version="1.0" encoding="UTF-8"?>
+<manifest>
+  <!-- remotes first -->
+  <remote  name="aosp"
+           fetch=".." />
+  <default revision="master" remote="aosp"/>
+
+  <project path="build/make" name="platform/build" groups="pdk" clone-depth="2" />
+  <project name='platform/art' path='art' clone-depth='a&amp;b'>
+    <copyfile src="a" dest="b"/>
+  </project>
+  <project name="platform/art" path="art2" revision="dev"></project>
+</manifest>
+`, string(e.Bytes()))
+
+	count, err = e.SetProjectAttr("platform/art", "art", "clone-depth", "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, count)
+
+	count, err = e.SetAttr("remote", func(attrs map[string]string) bool {
+		return attrs["name"] == "aosp"
+	}, "review", "https://android-review.googlesource.com/")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, count)
+
+	m := Manifest{}
+
+	err = xml.Unmarshal(e.Bytes(), &m)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "", m.Projects[1].CloneDepth)
+	assert.Equal(t, "https://android-review.googlesource.com/", m.Remotes[0].Review)
+
+	e = NewEditor([]byte("<manifest><project"))
+
+	_, err = e.SetProjectAttr("platform/art", "art", "clone-depth", "1")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestSetProjectAttrAt(t *testing.T) {
+	e := NewEditor([]byte(editManifest))
+
+	count, err := e.SetProjectAttrAt("platform/art", 9, "clone-depth", "2")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, count)
+
+	count, err = e.SetProjectAttrAt("platform/art", 8, "clone-depth", "2")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, count)
+
+	m := Manifest{}
+
+	err = xml.Unmarshal(e.Bytes(), &m)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "2", m.Projects[1].CloneDepth)
+	assert.Equal(t, "", m.Projects[0].CloneDepth)
+	assert.Equal(t, "", m.Projects[2].CloneDepth)
+
+	e = NewEditor([]byte(`<manifest><project name="platform/art"/><project name="platform/art" path="art2"/></manifest>`))
+
+	_, err = e.SetProjectAttrAt("platform/art", 1, "clone-depth", "2")
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, `<manifest><project name="platform/art"/><project name="platform/art" path="art2"/></manifest>`, string(e.Bytes()))
+}
+
+func TestEditWrite(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "manifest.xml")
+
+	err := os.WriteFile(name, []byte(editManifest), 0600)
+	assert.Equal(t, nil, err)
+
+	e, err := Edit(name)
+	assert.Equal(t, nil, err)
+
+	_, err = e.SetProjectAttr("platform/build", "build/make", "clone-depth", "2")
+	assert.Equal(t, nil, err)
+
+	err = e.Write(name)
+	assert.Equal(t, nil, err)
+
+	m := Manifest{}
+
+	err = m.Load(name)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "2", m.Projects[0].CloneDepth)
+
+	_, err = Edit(filepath.Join(t.TempDir(), "none.xml"))
+	assert.NotEqual(t, nil, err)
+}
@@ -0,0 +1,282 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ordered are the elements whose order against each other matters, which
+// share one slot of the canonical order and keep the order they are in.
+var ordered = map[string]bool{
+	"include":        true,
+	"remove-project": true,
+	"project":        true,
+	"extend-project": true,
+}
+
+var textEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// node is an element of a manifest being formatted.
+type node struct {
+	name     string
+	attrs    []xml.Attr
+	text     string
+	children []item
+	schema   *schema
+}
+
+// item is a child of an element, which is either an element or a comment.
+type item struct {
+	node    *node
+	comment string
+}
+
+// Canonical returns the XML manifest in buf in the canonical form, where
+// elements are ordered like the fields of Manifest, attributes like the fields
+// of their elements, remotes are sorted by name and projects by path. Include,
+// remove-project, extend-project and projects keep their order against each
+// other since it matters to them, so only the projects next to each other are
+// sorted. Comments are kept before the elements they precede, and unknown
+// elements and attributes are rejected rather than dropped.
+func Canonical(buf []byte) ([]byte, error) {
+	var out bytes.Buffer
+	var root *node
+	var before, after []string
+
+	d := xml.NewDecoder(bytes.NewReader(buf))
+
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "decode failed")
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			if root != nil || t.Name.Local != "manifest" {
+				return nil, errors.New("element " + t.Name.Local + " unsupported")
+			}
+			if root, err = parseNode(d, t, manifestSchema); err != nil {
+				return nil, err
+			}
+		case xml.Comment:
+			if root == nil {
+				before = append(before, string(t))
+			} else {
+				after = append(after, string(t))
+			}
+		case xml.Directive:
+			return nil, errors.New("directive unsupported")
+		}
+	}
+
+	if root == nil {
+		return nil, errors.New("manifest not found")
+	}
+
+	out.WriteString(xml.Header)
+
+	for _, val := range before {
+		out.WriteString("<!--" + val + "-->\n")
+	}
+
+	root.write(&out, 0)
+
+	for _, val := range after {
+		out.WriteString("<!--" + val + "-->\n")
+	}
+
+	return out.Bytes(), nil
+}
+
+// FormatFile rewrites the manifest in name to the canonical form, and returns
+// true if it was not canonical. The file is left untouched if check is true.
+func FormatFile(name string, check bool) (bool, error) {
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		return false, errors.Wrap(err, "read failed")
+	}
+
+	b, err := Canonical(buf)
+	if err != nil {
+		return false, errors.Wrap(err, "format failed")
+	}
+
+	if bytes.Equal(buf, b) {
+		return false, nil
+	}
+
+	if !check {
+		if err := os.WriteFile(name, b, perm); err != nil {
+			return true, errors.Wrap(err, "write failed")
+		}
+	}
+
+	return true, nil
+}
+
+func parseNode(d *xml.Decoder, start xml.StartElement, s *schema) (*node, error) {
+	n := &node{name: start.Name.Local, schema: s}
+
+	for _, val := range start.Attr {
+		if _, ok := s.attrs[val.Name.Local]; !ok || val.Name.Space != "" {
+			return nil, errors.New("attribute " + val.Name.Local + " of " + n.name + " unsupported")
+		}
+		n.attrs = append(n.attrs, val)
+	}
+
+	sort.SliceStable(n.attrs, func(i, j int) bool {
+		return s.attrs[n.attrs[i].Name.Local] < s.attrs[n.attrs[j].Name.Local]
+	})
+
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return nil, errors.Wrap(err, "decode failed")
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			child, ok := s.children[t.Name.Local]
+			if !ok {
+				return nil, errors.New("element " + t.Name.Local + " of " + n.name + " unsupported")
+			}
+			c, err := parseNode(d, t, child)
+			if err != nil {
+				return nil, err
+			}
+			n.children = append(n.children, item{node: c})
+		case xml.EndElement:
+			n.order()
+			return n, nil
+		case xml.CharData:
+			if s.text {
+				n.text += string(t)
+			} else if strings.TrimSpace(string(t)) != "" {
+				return nil, errors.New("text of " + n.name + " unsupported")
+			}
+		case xml.Comment:
+			if s.text {
+				return nil, errors.New("comment of " + n.name + " unsupported")
+			}
+			n.children = append(n.children, item{comment: string(t)})
+		default:
+			return nil, errors.New("token of " + n.name + " unsupported")
+		}
+	}
+}
+
+// order puts the children of n in slots like the fields of its type, where
+// comments go to the slot of the element they precede. Runs of remotes and
+// projects next to each other are sorted within their slots.
+func (n *node) order() {
+	var comments []item
+
+	slots := make([][]item, len(n.schema.slots))
+
+	for _, val := range n.children {
+		if val.node == nil {
+			comments = append(comments, val)
+			continue
+		}
+		slot := n.schema.slots[val.node.name]
+		slots[slot] = append(slots[slot], comments...)
+		slots[slot] = append(slots[slot], val)
+		comments = nil
+	}
+
+	n.children = nil
+
+	for _, val := range slots {
+		for start := 0; start < len(val); {
+			end := start + 1
+			for end < len(val) && sortable(val[start], val[end]) {
+				end++
+			}
+			run := val[start:end]
+			sort.SliceStable(run, func(i, j int) bool {
+				return run[i].node.key() < run[j].node.key()
+			})
+			start = end
+		}
+		n.children = append(n.children, val...)
+	}
+
+	n.children = append(n.children, comments...)
+}
+
+// sortable reports whether a and b are remotes or projects to sort together.
+func sortable(a, b item) bool {
+	return a.node != nil && b.node != nil && a.node.name == b.node.name &&
+		(a.node.name == "remote" || a.node.name == "project")
+}
+
+// key returns what remotes are sorted by, which is the name, or projects,
+// which is the path followed by the name.
+func (n *node) key() string {
+	attrs := map[string]string{}
+
+	for _, val := range n.attrs {
+		attrs[val.Name.Local] = val.Value
+	}
+
+	if n.name == "remote" {
+		return attrs["name"]
+	}
+
+	p := Project{Name: attrs["name"], Path: attrs["path"]}
+
+	return p.RelPath() + "\x00" + p.Name
+}
+
+func (n *node) write(out *bytes.Buffer, depth int) {
+	prefix := strings.Repeat(indent, depth)
+
+	out.WriteString(prefix + "<" + n.name)
+
+	for _, val := range n.attrs {
+		out.WriteString(" " + val.Name.Local + `="`)
+		_ = xml.EscapeText(out, []byte(val.Value))
+		out.WriteString(`"`)
+	}
+
+	switch {
+	case len(n.children) == 0 && n.text == "":
+		out.WriteString("/>\n")
+		return
+	case len(n.children) == 0:
+		out.WriteString(">" + textEscaper.Replace(n.text) + "</" + n.name + ">\n")
+		return
+	}
+
+	out.WriteString(">\n")
+
+	for _, val := range n.children {
+		if val.node == nil {
+			out.WriteString(prefix + indent + "<!--" + val.comment + "-->\n")
+			continue
+		}
+		val.node.write(out, depth+1)
+	}
+
+	out.WriteString(prefix + "</" + n.name + ">\n")
+}
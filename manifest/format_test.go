@@ -0,0 +1,164 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	canonicalManifest = `<?xml version="1.0" encoding="UTF-8"?>
+<manifest>
+  <remote name="aosp" fetch=".." review="https://android-review.googlesource.com/"/>
+  <remote name="github" fetch="https://github.com/"/>
+  <default remote="aosp" revision="master" sync-j="4"/>
+  <!-- projects -->
+  <project name="platform/art" path="art" groups="pdk"/>
+  <project name="platform/build" path="build/make" groups="pdk" clone-depth="100">
+    <copyfile src="core/root.mk" dest="Makefile"/>
+  </project>
+  <project name="foo/bar" remote="github"/>
+</manifest>
+`
+)
+
+func TestCanonical(t *testing.T) {
+	buf, err := Canonical([]byte(`<manifest>
+  <!-- projects -->
+  <project path="build/make" groups="pdk" clone-depth="100" name="platform/build">
+    <copyfile dest="Makefile" src="core/root.mk" />
+  </project>
+  <project name="foo/bar" remote="github"></project>
+  <project name="platform/art" path="art" groups="pdk"/>
+
+  <default sync-j="4" revision="master" remote="aosp"/>
+  <remote name="github" fetch="https://github.com/"/>
+  <remote review="https://android-review.googlesource.com/" name="aosp" fetch=".."/>
+</manifest>`))
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, canonicalManifest, string(buf))
+
+	buf, err = Canonical(buf)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, canonicalManifest, string(buf))
+
+	_, err = Canonical([]byte("<manifest><project"))
+	assert.NotEqual(t, nil, err)
+
+	_, err = Canonical([]byte(`<manifest><submanifest name="sub"/></manifest>`))
+	assert.NotEqual(t, nil, err)
+
+	_, err = Canonical([]byte(`<manifest><project name="x" unknown="y"/></manifest>`))
+	assert.NotEqual(t, nil, err)
+
+	_, err = Canonical([]byte(`<manifest><project name="x">text</project></manifest>`))
+	assert.NotEqual(t, nil, err)
+}
+
+func TestCanonicalOrder(t *testing.T) {
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<!-- header -->
+<manifest>
+  <notice>Terms &amp; conditions
+  apply.</notice>
+  <remote name="aosp" fetch=".."/>
+  <default remote="aosp" revision="master"/>
+  <include name="base.xml"/>
+  <project name="platform/x" path="x"/>
+  <project name="platform/y" path="y"/>
+  <remove-project name="platform/x"/>
+  <!-- re-added on dev -->
+  <project name="platform/x" path="x" revision="dev"/>
+  <project name="platform/z" path="z"/>
+  <extend-project name="platform/y" groups="pdk"/>
+  <project name="platform/a" path="a"/>
+  <!-- trailer -->
+</manifest>
+`
+
+	buf, err := Canonical([]byte(`<!-- header -->
+<manifest>
+  <include name="base.xml"/>
+  <project path="y" name="platform/y"/>
+  <project name="platform/x" path="x"/>
+  <remove-project name="platform/x"/>
+  <!-- re-added on dev -->
+  <project name="platform/z" path="z"/>
+  <project name="platform/x" path="x" revision="dev"/>
+  <extend-project name="platform/y" groups="pdk"/>
+  <project name="platform/a" path="a"/>
+  <default revision="master" remote="aosp"/>
+  <remote name="aosp" fetch=".."/>
+  <notice>Terms &amp; conditions
+  apply.</notice>
+  <!-- trailer -->
+</manifest>`))
+
+	assert.Equal(t, nil, err)
+	assert.Equal(t, expected, string(buf))
+
+	dir := t.TempDir()
+
+	err = os.WriteFile(filepath.Join(dir, "base.xml"), []byte(`<manifest/>`), 0600)
+	assert.Equal(t, nil, err)
+
+	err = os.WriteFile(filepath.Join(dir, "default.xml"), buf, 0600)
+	assert.Equal(t, nil, err)
+
+	violations, err := Validate(filepath.Join(dir, "default.xml"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(violations))
+
+	m := Manifest{}
+
+	err = m.Load(filepath.Join(dir, "default.xml"))
+	assert.Equal(t, nil, err)
+
+	p, err := m.Project("platform/x")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "dev", p.Revision)
+}
+
+func TestFormatFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "default.xml")
+
+	buf, err := os.ReadFile("../test/manifest-1.xml")
+	assert.Equal(t, nil, err)
+
+	err = os.WriteFile(name, buf, 0600)
+	assert.Equal(t, nil, err)
+
+	changed, err := FormatFile(name, true)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, changed)
+
+	b, err := os.ReadFile(name)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, string(buf), string(b))
+
+	changed, err = FormatFile(name, false)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, changed)
+
+	changed, err = FormatFile(name, true)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, changed)
+
+	_, err = FormatFile(filepath.Join(t.TempDir(), "none.xml"), true)
+	assert.NotEqual(t, nil, err)
+}
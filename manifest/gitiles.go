@@ -0,0 +1,41 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"gorepo/gitiles"
+)
+
+// LoadGitiles reads the manifest name in the manifest repository project at
+// revision from Gitiles, and expands its includes like Load does.
+func (m *Manifest) LoadGitiles(g *gitiles.Gitiles, project, revision, name string) error {
+	l := loader{
+		read: func(name string) ([]byte, error) {
+			return g.File(project, revision, filepath.ToSlash(name))
+		},
+	}
+
+	n := Manifest{}
+
+	if err := l.load(&n, name, nil); err != nil {
+		return errors.Wrap(err, "load failed")
+	}
+
+	*m = n
+
+	return nil
+}
@@ -0,0 +1,71 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gorepo/gitiles"
+)
+
+func TestLoadGitiles(t *testing.T) {
+	files := map[string]string{
+		"/platform/manifest/+/master/default.xml": `<manifest>
+  <remote fetch=".." name="aosp"/>
+  <default remote="aosp" revision="master"/>
+  <include name="sub/include.xml" groups="pdk"/>
+  <project name="platform/build" path="build/make"/>
+</manifest>`,
+		"/platform/manifest/+/master/sub/include.xml": `<manifest>
+  <project name="platform/art" path="art"/>
+</manifest>`,
+		"/platform/manifest/+/master/cycle.xml": `<manifest>
+  <include name="cycle.xml"/>
+</manifest>`,
+	}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte(base64.StdEncoding.EncodeToString([]byte(buf))))
+	}))
+	defer s.Close()
+
+	g := gitiles.Gitiles{}
+
+	err := g.Init(s.URL, "", "")
+	assert.Equal(t, nil, err)
+
+	m := Manifest{}
+
+	err = m.LoadGitiles(&g, "platform/manifest", "master", "default.xml")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(m.Projects))
+	assert.Equal(t, "platform/art", m.Projects[0].Name)
+	assert.Equal(t, "pdk", m.Projects[0].Groups)
+	assert.Equal(t, Source{File: "sub/include.xml", Line: 2}, m.Projects[0].Source())
+
+	err = m.LoadGitiles(&g, "platform/manifest", "master", "cycle.xml")
+	assert.NotEqual(t, nil, err)
+
+	err = m.LoadGitiles(&g, "platform/manifest", "master", "none.xml")
+	assert.NotEqual(t, nil, err)
+}
@@ -0,0 +1,102 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"runtime"
+	"strings"
+)
+
+const (
+	groupAll        = "all"
+	groupDefault    = "default"
+	groupName       = "name:"
+	groupNotDefault = "notdefault"
+	groupPath       = "path:"
+	groupPlatform   = "platform-"
+)
+
+// Groups parses groups as accepted by repo init --groups, which defaults to
+// "default", and adds the group of the current platform unless any platform
+// group is given.
+func Groups(groups string) []string {
+	buf := splitGroups(groups)
+	if len(buf) == 0 {
+		buf = []string{groupDefault}
+	}
+
+	for _, val := range buf {
+		if strings.HasPrefix(strings.TrimPrefix(val, "-"), groupPlatform) {
+			return buf
+		}
+	}
+
+	return append(buf, groupPlatform+runtime.GOOS)
+}
+
+// GroupList returns the groups of project, including the implicit ones of
+// all, name:NAME, path:PATH and default unless it is in notdefault.
+func (p Project) GroupList() []string {
+	buf := []string{groupAll, groupName + p.Name, groupPath + p.RelPath()}
+	buf = append(buf, splitGroups(p.Groups)...)
+
+	for _, val := range buf {
+		if val == groupNotDefault {
+			return buf
+		}
+	}
+
+	return append(buf, groupDefault)
+}
+
+// MatchGroups returns true if project is selected by groups returned by Groups,
+// where -GROUP excludes projects in GROUP and the last matched one wins.
+func (p Project) MatchGroups(groups []string) bool {
+	matched := false
+
+	buf := map[string]bool{}
+
+	for _, val := range p.GroupList() {
+		buf[val] = true
+	}
+
+	for _, val := range groups {
+		if strings.HasPrefix(val, "-") && buf[val[1:]] {
+			matched = false
+		} else if buf[val] {
+			matched = true
+		}
+	}
+
+	return matched
+}
+
+// Select returns the projects of m selected by groups returned by Groups,
+// including the nested ones named and placed as Flatten does.
+func (m Manifest) Select(groups []string) []Project {
+	var buf []Project
+
+	for _, val := range m.Flatten() {
+		if val.MatchGroups(groups) {
+			buf = append(buf, val)
+		}
+	}
+
+	return buf
+}
+
+func splitGroups(groups string) []string {
+	return strings.FieldsFunc(groups, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+}
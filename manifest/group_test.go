@@ -0,0 +1,62 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroups(t *testing.T) {
+	assert.Equal(t, []string{"default", "platform-" + runtime.GOOS}, Groups(""))
+	assert.Equal(t, []string{"pdk", "-tradefed", "platform-" + runtime.GOOS}, Groups("pdk, -tradefed"))
+	assert.Equal(t, []string{"default", "platform-darwin"}, Groups("default,platform-darwin"))
+	assert.Equal(t, []string{"all", "-platform-darwin"}, Groups("all,-platform-darwin"))
+}
+
+func TestGroupList(t *testing.T) {
+	p := Project{Name: "platform/art", Path: "art", Groups: "pdk,tradefed"}
+	assert.Equal(t, []string{"all", "name:platform/art", "path:art", "pdk", "tradefed", "default"}, p.GroupList())
+
+	p.Groups = "notdefault"
+	assert.Equal(t, []string{"all", "name:platform/art", "path:art", "notdefault"}, p.GroupList())
+}
+
+func TestMatchGroups(t *testing.T) {
+	p := Project{Name: "platform/art", Path: "art", Groups: "pdk,tradefed"}
+	assert.Equal(t, true, p.MatchGroups(Groups("")))
+	assert.Equal(t, true, p.MatchGroups(Groups("pdk")))
+	assert.Equal(t, false, p.MatchGroups(Groups("pdk,-tradefed")))
+	assert.Equal(t, true, p.MatchGroups(Groups("-tradefed,pdk")))
+	assert.Equal(t, true, p.MatchGroups(Groups("name:platform/art")))
+	assert.Equal(t, false, p.MatchGroups(Groups("device")))
+
+	p.Groups = "notdefault,platform-darwin"
+	assert.Equal(t, false, p.MatchGroups(Groups("")))
+	assert.Equal(t, true, p.MatchGroups(Groups("default,platform-darwin")))
+	assert.Equal(t, true, p.MatchGroups(Groups("all")))
+}
+
+func TestSelect(t *testing.T) {
+	m := Manifest{}
+
+	err := m.Load("../test/manifest-1.xml")
+	assert.Equal(t, nil, err)
+
+	assert.Equal(t, 4, len(m.Select(Groups(""))))
+	assert.Equal(t, 2, len(m.Select(Groups("tradefed"))))
+	assert.Equal(t, 2, len(m.Select(Groups("pdk,-tradefed"))))
+	assert.Equal(t, 0, len(m.Select(Groups("device"))))
+}
@@ -0,0 +1,443 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	manifestsDir = "manifests"
+)
+
+type loader struct {
+	dir        string
+	read       func(string) ([]byte, error)
+	stack      []frame
+	violations *[]Violation
+	paths      map[string]Source
+}
+
+// frame is a manifest being loaded, with the include element it comes from.
+type frame struct {
+	name    string
+	include Include
+}
+
+// includeDir returns the directory includes of name are relative to, which
+// is .repo/manifests for .repo/manifest.xml and the directory of name otherwise.
+func includeDir(name string) string {
+	dir := filepath.Dir(name)
+
+	if info, err := os.Stat(filepath.Join(dir, manifestsDir)); err == nil && info.IsDir() {
+		return filepath.Join(dir, manifestsDir)
+	}
+
+	return dir
+}
+
+func (l *loader) load(m *Manifest, name string, i *Include) error {
+	for _, val := range l.stack {
+		if val.name == name {
+			var names []string
+			for _, item := range l.stack {
+				names = append(names, item.name)
+			}
+			return newViolation(i.source, Error, ruleInclude, "include cycle: %s -> %s", strings.Join(names, " -> "), name)
+		}
+	}
+
+	buf, err := l.read(name)
+	if err != nil {
+		return errors.Wrap(err, "read failed")
+	}
+
+	f := frame{name: name}
+	if i != nil {
+		f.include = *i
+	}
+
+	l.stack = append(l.stack, f)
+	defer func() {
+		l.stack = l.stack[:len(l.stack)-1]
+	}()
+
+	return l.parse(m, name, buf)
+}
+
+// nolint: funlen,gocyclo
+func (l *loader) parse(m *Manifest, name string, buf []byte) error {
+	lines := newLineIndex(buf)
+	d := xml.NewDecoder(bytes.NewReader(buf))
+
+	if l.violations != nil {
+		*l.violations = append(*l.violations, checkSchema(name, buf)...)
+	}
+
+	root := false
+
+	for {
+		offset := d.InputOffset()
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return errors.Wrapf(err, "%s: parse failed", name)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		source := Source{File: name, Line: lines.line(offset)}
+
+		if !root {
+			if start.Name.Local != "manifest" {
+				return errors.Errorf("%s: manifest invalid", source)
+			}
+			root = true
+			continue
+		}
+
+		n := Manifest{}
+
+		switch start.Name.Local {
+		case "notice":
+			err = d.DecodeElement(&n.Notice, &start)
+		case "remote":
+			n.Remotes = make([]Remote, 1)
+			err = d.DecodeElement(&n.Remotes[0], &start)
+		case "default":
+			n.Default = &Default{}
+			err = d.DecodeElement(n.Default, &start)
+		case "manifest-server":
+			n.ManifestServer = &ManifestServer{}
+			err = d.DecodeElement(n.ManifestServer, &start)
+		case "superproject":
+			n.Superproject = &Superproject{}
+			err = d.DecodeElement(n.Superproject, &start)
+		case "contactinfo":
+			n.ContactInfo = &ContactInfo{}
+			err = d.DecodeElement(n.ContactInfo, &start)
+		case "include":
+			n.Includes = make([]Include, 1)
+			err = d.DecodeElement(&n.Includes[0], &start)
+		case "remove-project":
+			n.RemoveProjects = make([]RemoveProject, 1)
+			err = d.DecodeElement(&n.RemoveProjects[0], &start)
+		case "project":
+			n.Projects = make([]Project, 1)
+			err = d.DecodeElement(&n.Projects[0], &start)
+		case "extend-project":
+			n.ExtendProjects = make([]ExtendProject, 1)
+			err = d.DecodeElement(&n.ExtendProjects[0], &start)
+		case "repo-hooks":
+			n.RepoHooks = &RepoHooks{}
+			err = d.DecodeElement(n.RepoHooks, &start)
+		default:
+			err = d.Skip()
+		}
+
+		if err != nil {
+			return errors.Wrapf(err, "%s: %s invalid", source, start.Name.Local)
+		}
+
+		n.setSource(source)
+
+		if len(n.Projects) != 0 {
+			n.Projects[0].setNestedSources(source, buf[offset:d.InputOffset()], offset, lines)
+		}
+
+		if len(n.Includes) != 0 {
+			err = l.include(m, &n.Includes[0])
+		} else {
+			l.inherit(&n)
+			err = m.merge(&n, source, l.projectPaths(m))
+			if len(n.RemoveProjects) != 0 || len(n.ExtendProjects) != 0 {
+				l.paths = nil
+			}
+		}
+
+		if v, ok := err.(Violation); ok && l.violations != nil {
+			*l.violations = append(*l.violations, v)
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if !root {
+		return errors.Errorf("%s: manifest invalid", name)
+	}
+
+	return nil
+}
+
+func (l *loader) include(m *Manifest, i *Include) error {
+	if i.Name == "" || path.IsAbs(i.Name) || strings.HasPrefix(path.Clean(i.Name), "..") {
+		return newViolation(i.source, Error, ruleInclude, "include name %s invalid", i.Name)
+	}
+
+	if err := l.load(m, filepath.Join(l.dir, filepath.FromSlash(i.Name)), i); err != nil {
+		if _, ok := err.(Violation); ok {
+			return err
+		}
+		return newViolation(i.source, Error, ruleInclude, "include %s failed: %v", i.Name, err)
+	}
+
+	return nil
+}
+
+// inherit applies groups and revision of the includes being loaded to the
+// projects in n, the innermost include taking precedence for revision.
+func (l *loader) inherit(n *Manifest) {
+	for index := range n.Projects {
+		p := &n.Projects[index]
+		for i := len(l.stack) - 1; i >= 0; i-- {
+			include := l.stack[i].include
+			if include.Groups != "" {
+				p.Groups = joinGroups(p.Groups, include.Groups)
+			}
+			if include.Revision != "" && p.Revision == "" {
+				p.Revision = include.Revision
+			}
+		}
+	}
+}
+
+// merge merges the elements of n from source s into m, which fails if any
+// of them conflicts with the one in m.
+// nolint: gocyclo
+func (m *Manifest) merge(n *Manifest, s Source, paths map[string]Source) error {
+	if n.Notice != "" {
+		if m.Notice != "" && m.Notice != n.Notice {
+			return newViolation(s, Error, ruleDuplicate, "notice duplicated")
+		}
+		m.Notice = n.Notice
+	}
+
+	for index := range n.Remotes {
+		if err := m.mergeRemote(&n.Remotes[index]); err != nil {
+			return err
+		}
+	}
+
+	if n.Default != nil {
+		if m.Default != nil && !m.Default.equal(n.Default) {
+			return newViolation(s, Error, ruleDuplicate, "default duplicated (first defined at %s)", m.Default.source)
+		}
+		m.Default = n.Default
+	}
+
+	if n.ManifestServer != nil {
+		if m.ManifestServer != nil && *m.ManifestServer != *n.ManifestServer {
+			return newViolation(s, Error, ruleDuplicate, "manifest-server duplicated")
+		}
+		m.ManifestServer = n.ManifestServer
+	}
+
+	if n.Superproject != nil {
+		if m.Superproject != nil && *m.Superproject != *n.Superproject {
+			return newViolation(s, Error, ruleDuplicate, "superproject duplicated")
+		}
+		m.Superproject = n.Superproject
+	}
+
+	if n.ContactInfo != nil {
+		m.ContactInfo = n.ContactInfo
+	}
+
+	if n.RepoHooks != nil {
+		if m.RepoHooks != nil && *m.RepoHooks != *n.RepoHooks {
+			return newViolation(s, Error, ruleDuplicate, "repo-hooks duplicated")
+		}
+		m.RepoHooks = n.RepoHooks
+	}
+
+	for index := range n.RemoveProjects {
+		if err := m.removeProject(&n.RemoveProjects[index]); err != nil {
+			return err
+		}
+	}
+
+	for index := range n.Projects {
+		if err := m.mergeProject(&n.Projects[index], paths); err != nil {
+			return err
+		}
+	}
+
+	for index := range n.ExtendProjects {
+		if err := m.extendProject(&n.ExtendProjects[index]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Manifest) mergeRemote(r *Remote) error {
+	for _, val := range m.Remotes {
+		if val.Name != r.Name {
+			continue
+		}
+		if !val.equal(r) {
+			return newViolation(r.source, Error, ruleDuplicate, "remote %s duplicated (first defined at %s)", r.Name, val.source)
+		}
+		return nil
+	}
+
+	m.Remotes = append(m.Remotes, *r)
+
+	return nil
+}
+
+// mergeProject appends p to m unless a project is in the same path, where paths
+// holds the sources of the projects of m by path.
+func (m *Manifest) mergeProject(p *Project, paths map[string]Source) error {
+	if s, ok := paths[p.RelPath()]; ok {
+		return newViolation(p.source, Error, ruleDuplicate, "project %s duplicated in path %s (first defined at %s)",
+			p.Name, p.RelPath(), s)
+	}
+
+	paths[p.RelPath()] = p.source
+	m.Projects = append(m.Projects, *p)
+
+	return nil
+}
+
+// projectPaths returns the sources of the projects of m by path, which is
+// built on the first call and after projects are removed or extended.
+func (l *loader) projectPaths(m *Manifest) map[string]Source {
+	if l.paths == nil {
+		l.paths = map[string]Source{}
+		for _, val := range m.Projects {
+			if _, ok := l.paths[val.RelPath()]; !ok {
+				l.paths[val.RelPath()] = val.source
+			}
+		}
+	}
+
+	return l.paths
+}
+
+// setSource sets the source of every element in m.
+func (m *Manifest) setSource(s Source) {
+	for index := range m.Remotes {
+		m.Remotes[index].source = s
+	}
+
+	if m.Default != nil {
+		m.Default.source = s
+	}
+
+	for index := range m.Includes {
+		m.Includes[index].source = s
+	}
+
+	for index := range m.RemoveProjects {
+		m.RemoveProjects[index].source = s
+	}
+
+	for index := range m.Projects {
+		m.Projects[index].setSource(s)
+	}
+
+	for index := range m.ExtendProjects {
+		m.ExtendProjects[index].source = s
+	}
+}
+
+func (p *Project) setSource(s Source) {
+	p.source = s
+
+	for index := range p.Projects {
+		p.Projects[index].setSource(s)
+	}
+}
+
+// setNestedSources sets the sources of the projects nested in p to the lines
+// of their start tags, where buf holds p at offset of the file.
+func (p *Project) setNestedSources(s Source, buf []byte, offset int64, lines lineIndex) {
+	var nested []*Project
+
+	walkProjects(p.Projects, func(val *Project) {
+		nested = append(nested, val)
+	})
+
+	d := xml.NewDecoder(bytes.NewReader(buf))
+	index := -1
+
+	for index < len(nested) {
+		start := d.InputOffset()
+		token, err := d.Token()
+		if err != nil {
+			return
+		}
+		if t, ok := token.(xml.StartElement); ok && t.Name.Local == "project" {
+			if index >= 0 {
+				nested[index].source = Source{File: s.File, Line: lines.line(offset + start)}
+			}
+			index++
+		}
+	}
+}
+
+func (d *Default) equal(o *Default) bool {
+	a, b := *d, *o
+	a.source, b.source = Source{}, Source{}
+
+	return a == b
+}
+
+func (r *Remote) equal(o *Remote) bool {
+	if len(r.Annotations) != len(o.Annotations) {
+		return false
+	}
+
+	for index := range r.Annotations {
+		if r.Annotations[index] != o.Annotations[index] {
+			return false
+		}
+	}
+
+	return r.Name == o.Name && r.Alias == o.Alias && r.Fetch == o.Fetch &&
+		r.PushUrl == o.PushUrl && r.Review == o.Review && r.Revision == o.Revision
+}
+
+// lineIndex holds the offsets of line breaks for mapping offsets to lines.
+type lineIndex []int
+
+func newLineIndex(buf []byte) lineIndex {
+	var l lineIndex
+
+	for index, val := range buf {
+		if val == '\n' {
+			l = append(l, index)
+		}
+	}
+
+	return l
+}
+
+func (l lineIndex) line(offset int64) int {
+	return sort.SearchInts(l, int(offset)) + 1
+}
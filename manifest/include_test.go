@@ -0,0 +1,134 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for key, val := range files {
+		name := filepath.Join(dir, key)
+		err := os.MkdirAll(filepath.Dir(name), 0755)
+		assert.Equal(t, nil, err)
+		err = os.WriteFile(name, []byte(val), 0600)
+		assert.Equal(t, nil, err)
+	}
+}
+
+func TestInclude(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFiles(t, dir, map[string]string{
+		"default.xml": `<manifest>
+  <remote fetch=".." name="aosp"/>
+  <default remote="aosp" revision="master"/>
+  <project name="platform/build" path="build/make"/>
+  <include name="sub/a.xml" groups="vendor" revision="android10-release"/>
+  <project name="platform/art" path="art"/>
+</manifest>`,
+		"sub/a.xml": `<manifest>
+  <remote fetch=".." name="aosp"/>
+  <project name="vendor/a" groups="pdk"/>
+  <include name="b.xml"/>
+</manifest>`,
+		"b.xml": `<manifest>
+  <project name="vendor/b" revision="main"/>
+</manifest>`,
+	})
+
+	m := Manifest{}
+
+	err := m.Load(filepath.Join(dir, "default.xml"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(m.Remotes))
+	assert.Equal(t, 4, len(m.Projects))
+	assert.Equal(t, "platform/build", m.Projects[0].Name)
+	assert.Equal(t, "vendor/a", m.Projects[1].Name)
+	assert.Equal(t, "pdk,vendor", m.Projects[1].Groups)
+	assert.Equal(t, "android10-release", m.Projects[1].Revision)
+	assert.Equal(t, "vendor/b", m.Projects[2].Name)
+	assert.Equal(t, "main", m.Projects[2].Revision)
+	assert.Equal(t, "platform/art", m.Projects[3].Name)
+	assert.Equal(t, filepath.Join(dir, "sub/a.xml")+":3", m.Projects[1].Source().String())
+	assert.Equal(t, filepath.Join(dir, "default.xml")+":6", m.Projects[3].Source().String())
+	assert.Equal(t, 0, len(m.Includes))
+}
+
+func TestIncludeDir(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFiles(t, dir, map[string]string{
+		".repo/manifest.xml":          `<manifest><include name="default.xml"/></manifest>`,
+		".repo/manifests/default.xml": `<manifest><project name="platform/art"/></manifest>`,
+	})
+
+	m := Manifest{}
+
+	err := m.Load(filepath.Join(dir, ".repo/manifest.xml"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(m.Projects))
+}
+
+func TestIncludeInvalid(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFiles(t, dir, map[string]string{
+		"cycle.xml":    `<manifest><include name="a.xml"/></manifest>`,
+		"a.xml":        `<manifest><include name="cycle.xml"/></manifest>`,
+		"dup.xml":      "<manifest>\n<project name=\"a\" path=\"x\"/>\n<include name=\"dup-sub.xml\"/>\n</manifest>",
+		"dup-sub.xml":  "<manifest>\n\n<project name=\"b\" path=\"x\"/>\n</manifest>",
+		"missing.xml":  `<manifest><include name="none.xml"/></manifest>`,
+		"escape.xml":   `<manifest><include name="../escape.xml"/></manifest>`,
+		"remote.xml":   "<manifest>\n<remote name=\"aosp\" fetch=\"..\"/>\n<remote name=\"aosp\" fetch=\"/\"/>\n</manifest>",
+		"syntax.xml":   "<manifest>\n<project name=\"a\">\n</manifest>",
+		"root.xml":     `<project name="a"/>`,
+		"default2.xml": "<manifest>\n<default revision=\"a\"/>\n<default revision=\"b\"/>\n</manifest>",
+	})
+
+	m := Manifest{}
+
+	err := m.Load(filepath.Join(dir, "cycle.xml"))
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, true, strings.Contains(err.Error(), "include cycle"))
+
+	err = m.Load(filepath.Join(dir, "dup.xml"))
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, true, strings.Contains(err.Error(), filepath.Join(dir, "dup-sub.xml")+":3"))
+	assert.Equal(t, true, strings.Contains(err.Error(), filepath.Join(dir, "dup.xml")+":2"))
+
+	err = m.Load(filepath.Join(dir, "missing.xml"))
+	assert.NotEqual(t, nil, err)
+
+	err = m.Load(filepath.Join(dir, "escape.xml"))
+	assert.NotEqual(t, nil, err)
+
+	err = m.Load(filepath.Join(dir, "remote.xml"))
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, true, strings.Contains(err.Error(), filepath.Join(dir, "remote.xml")+":3"))
+
+	err = m.Load(filepath.Join(dir, "syntax.xml"))
+	assert.NotEqual(t, nil, err)
+
+	err = m.Load(filepath.Join(dir, "root.xml"))
+	assert.NotEqual(t, nil, err)
+
+	err = m.Load(filepath.Join(dir, "default2.xml"))
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, true, strings.Contains(err.Error(), filepath.Join(dir, "default2.xml")+":3"))
+}
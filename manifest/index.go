@@ -0,0 +1,99 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Index looks up projects of a manifest by name, path and group in constant
+// time. It is a snapshot of the projects when created, and needs to be
+// created again once they change.
+type Index struct {
+	projects []Project
+	names    map[string][]int
+	paths    map[string]int
+	groups   map[string][]int
+}
+
+// NewIndex returns the index of the projects of m, where groups include the
+// implicit ones returned by GroupList.
+func NewIndex(m *Manifest) *Index {
+	i := &Index{
+		projects: m.Projects,
+		names:    map[string][]int{},
+		paths:    map[string]int{},
+		groups:   map[string][]int{},
+	}
+
+	for index, val := range m.Projects {
+		i.names[val.Name] = append(i.names[val.Name], index)
+		if _, ok := i.paths[val.RelPath()]; !ok {
+			i.paths[val.RelPath()] = index
+		}
+		for _, group := range val.GroupList() {
+			i.groups[group] = append(i.groups[group], index)
+		}
+	}
+
+	return i
+}
+
+// stale reports whether projects is not the slice i was created from.
+func (i *Index) stale(projects []Project) bool {
+	if len(projects) != len(i.projects) {
+		return true
+	}
+
+	return len(projects) != 0 && &projects[0] != &i.projects[0]
+}
+
+// Project returns the first project of name.
+func (i *Index) Project(name string) (Project, error) {
+	buf, ok := i.names[name]
+	if !ok {
+		return Project{}, errors.New("project not found")
+	}
+
+	return i.projects[buf[0]], nil
+}
+
+// Projects returns the projects of name, which are in different paths.
+func (i *Index) Projects(name string) []Project {
+	return i.pick(i.names[name])
+}
+
+// Path returns the project in path.
+func (i *Index) Path(path string) (Project, error) {
+	index, ok := i.paths[path]
+	if !ok {
+		return Project{}, errors.New("project not found")
+	}
+
+	return i.projects[index], nil
+}
+
+// Group returns the projects in group in order.
+func (i *Index) Group(group string) []Project {
+	return i.pick(i.groups[group])
+}
+
+func (i *Index) pick(indexes []int) []Project {
+	var buf []Project
+
+	for _, val := range indexes {
+		buf = append(buf, i.projects[val])
+	}
+
+	return buf
+}
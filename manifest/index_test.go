@@ -0,0 +1,180 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	benchProjects = 2000
+)
+
+func TestIndex(t *testing.T) {
+	m := Manifest{}
+
+	err := m.Load("../test/manifest-1.xml")
+	assert.Equal(t, nil, err)
+
+	m.Projects = append(m.Projects, Project{Name: "platform/art", Path: "art2", Groups: "notdefault"})
+
+	i := NewIndex(&m)
+
+	p, err := i.Project("platform/art")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "art", p.Path)
+
+	_, err = i.Project("platform/none")
+	assert.NotEqual(t, nil, err)
+
+	assert.Equal(t, 2, len(i.Projects("platform/art")))
+	assert.Equal(t, 0, len(i.Projects("platform/none")))
+
+	p, err = i.Path("build/soong")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "platform/build/soong", p.Name)
+
+	_, err = i.Path("none")
+	assert.NotEqual(t, nil, err)
+
+	assert.Equal(t, 2, len(i.Group("tradefed")))
+	assert.Equal(t, 4, len(i.Group("default")))
+	assert.Equal(t, 5, len(i.Group("all")))
+	assert.Equal(t, 1, len(i.Group("name:platform/build")))
+	assert.Equal(t, 0, len(i.Group("none")))
+}
+
+// newBench writes a manifest of benchProjects projects split into includes.
+func newBench(b *testing.B) string {
+	dir := b.TempDir()
+
+	var main, include strings.Builder
+
+	main.WriteString(`<manifest>
+  <remote fetch=".." name="aosp"/>
+  <default remote="aosp" revision="master"/>
+  <include name="include.xml"/>
+`)
+	include.WriteString("<manifest>\n")
+
+	for index := 0; index < benchProjects; index++ {
+		buf := &main
+		if index%2 != 0 {
+			buf = &include
+		}
+		fmt.Fprintf(buf, "  <project name=\"platform/p%d\" path=\"p/%d\" groups=\"g%d\"/>\n", index, index, index%10)
+	}
+
+	main.WriteString("</manifest>\n")
+	include.WriteString("</manifest>\n")
+
+	if err := os.WriteFile(filepath.Join(dir, "default.xml"), []byte(main.String()), 0600); err != nil {
+		b.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "include.xml"), []byte(include.String()), 0600); err != nil {
+		b.Fatal(err)
+	}
+
+	return filepath.Join(dir, "default.xml")
+}
+
+func loadBench(b *testing.B) Manifest {
+	m := Manifest{}
+
+	if err := m.Load(newBench(b)); err != nil {
+		b.Fatal(err)
+	}
+
+	return m
+}
+
+func BenchmarkLoad(b *testing.B) {
+	name := newBench(b)
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		m := Manifest{}
+		if err := m.Load(name); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkNewIndex(b *testing.B) {
+	m := loadBench(b)
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		NewIndex(&m)
+	}
+}
+
+func BenchmarkProject(b *testing.B) {
+	m := loadBench(b)
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		if _, err := m.Project(fmt.Sprintf("platform/p%d", n%benchProjects)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkIndexProject(b *testing.B) {
+	m := loadBench(b)
+	i := NewIndex(&m)
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		if _, err := i.Project(fmt.Sprintf("platform/p%d", n%benchProjects)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkIndexPath(b *testing.B) {
+	m := loadBench(b)
+	i := NewIndex(&m)
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		if _, err := i.Path(fmt.Sprintf("p/%d", n%benchProjects)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkIndexGroup(b *testing.B) {
+	m := loadBench(b)
+	i := NewIndex(&m)
+
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		if len(i.Group(fmt.Sprintf("g%d", n%10))) == 0 {
+			b.Fatal("group not found")
+		}
+	}
+}
@@ -0,0 +1,150 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	localManifests = "local_manifests"
+	optionalTrue   = "true"
+)
+
+// LocalDir returns the local manifests directory next to the manifest in name,
+// e.g. .repo/local_manifests for .repo/manifest.xml.
+func LocalDir(name string) string {
+	return filepath.Join(filepath.Dir(name), localManifests)
+}
+
+// Overlay merges the manifests in dir on top of m in lexical order, which
+// is a no-op if dir does not exist.
+func (m *Manifest) Overlay(dir string) error {
+	return m.overlay(dir, os.ReadFile)
+}
+
+func (m *Manifest) overlay(dir string, read func(string) ([]byte, error)) error {
+	names, err := filepath.Glob(filepath.Join(dir, "*.xml"))
+	if err != nil {
+		return errors.Wrap(err, "glob failed")
+	}
+
+	sort.Strings(names)
+
+	for _, val := range names {
+		l := loader{
+			dir:  dir,
+			read: read,
+		}
+		if err := l.load(m, val, nil); err != nil {
+			return errors.Wrap(err, "overlay failed")
+		}
+	}
+
+	return nil
+}
+
+func (m *Manifest) removeProject(r *RemoveProject) error {
+	var projects []Project
+
+	if r.Name == "" && r.Path == "" {
+		return newViolation(r.source, Error, ruleRemove, "remove-project name or path required")
+	}
+
+	for _, val := range m.Projects {
+		if (r.Name == "" || val.Name == r.Name) && (r.Path == "" || val.RelPath() == r.Path) {
+			if rev, _ := m.Revision(val); r.BaseRev != "" && rev != r.BaseRev {
+				return newViolation(r.source, Error, ruleRemove, "remove-project %s base-rev %s mismatched with revision %s",
+					val.Name, r.BaseRev, rev)
+			}
+			continue
+		}
+		projects = append(projects, val)
+	}
+
+	if len(projects) == len(m.Projects) && r.Optional != optionalTrue {
+		name := r.Name
+		if name == "" {
+			name = r.Path
+		}
+		return newViolation(r.source, Error, ruleRemove, "remove-project %s not found", name)
+	}
+
+	m.Projects = projects
+
+	return nil
+}
+
+// nolint: gocyclo
+func (m *Manifest) extendProject(e *ExtendProject) error {
+	var matched []int
+
+	for index, val := range m.Projects {
+		if val.Name == e.Name && (e.Path == "" || val.RelPath() == e.Path) {
+			matched = append(matched, index)
+		}
+	}
+
+	if len(matched) == 0 {
+		return newViolation(e.source, Error, ruleExtend, "extend-project %s not found", e.Name)
+	}
+
+	if e.DestPath != "" && len(matched) != 1 {
+		return newViolation(e.source, Error, ruleExtend, "extend-project %s dest-path requires a single project", e.Name)
+	}
+
+	for _, index := range matched {
+		p := &m.Projects[index]
+		if rev, _ := m.Revision(*p); e.BaseRev != "" && rev != e.BaseRev {
+			return newViolation(e.source, Error, ruleExtend, "extend-project %s base-rev %s mismatched with revision %s",
+				p.Name, e.BaseRev, rev)
+		}
+		if e.DestPath != "" {
+			p.Path = e.DestPath
+		}
+		if e.Groups != "" {
+			p.Groups = joinGroups(p.Groups, e.Groups)
+		}
+		if e.Revision != "" {
+			p.Revision = e.Revision
+		}
+		if e.Remote != "" {
+			p.Remote = e.Remote
+		}
+		if e.DestBranch != "" {
+			p.DestBranch = e.DestBranch
+		}
+		if e.Upstream != "" {
+			p.Upstream = e.Upstream
+		}
+	}
+
+	return nil
+}
+
+func joinGroups(groups ...string) string {
+	var buf []string
+
+	for _, val := range groups {
+		if val != "" {
+			buf = append(buf, val)
+		}
+	}
+
+	return strings.Join(buf, ",")
+}
@@ -0,0 +1,116 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalDir(t *testing.T) {
+	assert.Equal(t, filepath.Join(".repo", "local_manifests"), LocalDir(".repo/manifest.xml"))
+}
+
+func TestOverlay(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFiles(t, dir, map[string]string{
+		".repo/manifest.xml": `<manifest>
+  <remote fetch=".." name="aosp"/>
+  <default remote="aosp" revision="master"/>
+  <project name="platform/build" path="build/make"/>
+  <project name="platform/art" path="art"/>
+  <project name="platform/bionic" path="bionic"/>
+</manifest>`,
+		".repo/local_manifests/01-remove.xml": `<manifest>
+  <remove-project name="platform/bionic"/>
+  <remove-project name="platform/none" optional="true"/>
+</manifest>`,
+		".repo/local_manifests/02-extend.xml": `<manifest>
+  <remote fetch="https://github.com" name="github"/>
+  <extend-project name="platform/art" groups="mine" revision="dev" base-rev="master"/>
+  <remove-project name="platform/build"/>
+  <project name="mine/build" path="build/make" remote="github"/>
+</manifest>`,
+		".repo/local_manifests/README.md": `not a manifest`,
+	})
+
+	name := filepath.Join(dir, ".repo/manifest.xml")
+
+	m := Manifest{}
+
+	err := m.Load(name)
+	assert.Equal(t, nil, err)
+
+	err = m.Overlay(LocalDir(name))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(m.Remotes))
+	assert.Equal(t, 2, len(m.Projects))
+	assert.Equal(t, "platform/art", m.Projects[0].Name)
+	assert.Equal(t, "mine", m.Projects[0].Groups)
+	assert.Equal(t, "dev", m.Projects[0].Revision)
+	assert.Equal(t, "mine/build", m.Projects[1].Name)
+
+	err = m.Overlay(filepath.Join(dir, "none"))
+	assert.Equal(t, nil, err)
+
+	writeFiles(t, dir, map[string]string{
+		"move/a.xml": `<manifest>
+  <extend-project name="platform/art" dest-path="art2"/>
+  <project name="mine/art" path="art" remote="github"/>
+</manifest>`,
+	})
+
+	err = m.Overlay(filepath.Join(dir, "move"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "art2", m.Projects[0].Path)
+	assert.Equal(t, "mine/art", m.Projects[2].Name)
+}
+
+func TestOverlayInvalid(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFiles(t, dir, map[string]string{
+		"default.xml":             `<manifest><project name="a" revision="master"/></manifest>`,
+		"remove/a.xml":            "<manifest>\n<remove-project name=\"b\"/>\n</manifest>",
+		"extend/a.xml":            `<manifest><extend-project name="b"/></manifest>`,
+		"base/a.xml":              `<manifest><extend-project name="a" base-rev="main"/></manifest>`,
+		"duplicate/a.xml":         `<manifest><project name="b" path="a"/></manifest>`,
+		"remove-base/a.xml":       `<manifest><remove-project name="a" base-rev="main"/></manifest>`,
+		"remove-empty/a.xml":      `<manifest><remove-project/></manifest>`,
+		"extend-dest-path/a.xml":  `<manifest><project name="a" path="b"/><extend-project name="a" dest-path="c"/></manifest>`,
+		"extend-dest-path2/a.xml": `<manifest><extend-project name="a" dest-path="c"/></manifest>`,
+	})
+
+	for _, val := range []string{"remove", "extend", "base", "duplicate", "remove-base", "remove-empty", "extend-dest-path"} {
+		m := Manifest{}
+		err := m.Load(filepath.Join(dir, "default.xml"))
+		assert.Equal(t, nil, err)
+		err = m.Overlay(filepath.Join(dir, val))
+		assert.NotEqual(t, nil, err, val)
+	}
+
+	m := Manifest{}
+
+	_ = m.Load(filepath.Join(dir, "default.xml"))
+	err := m.Overlay(filepath.Join(dir, "remove"))
+	assert.Equal(t, true, strings.Contains(err.Error(), filepath.Join(dir, "remove", "a.xml")+":2"))
+
+	_ = m.Load(filepath.Join(dir, "default.xml"))
+	err = m.Overlay(filepath.Join(dir, "extend-dest-path2"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "c", m.Projects[0].RelPath())
+}
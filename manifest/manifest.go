@@ -13,107 +13,310 @@
 package manifest
 
 import (
-	"github.com/clbanning/mxj"
+	"encoding/xml"
+	"os"
+	"strconv"
+
 	"github.com/pkg/errors"
 )
 
+const (
+	indent = "  "
+	perm   = 0644
+)
+
+// Manifest
+//
+// Reference: https://gerrit.googlesource.com/git-repo/+/refs/heads/main/docs/manifest-format.md
 type Manifest struct {
-	manifest mxj.Maps
+	XMLName        xml.Name        `xml:"manifest" json:"-" yaml:"-"`
+	Notice         string          `xml:"notice,omitempty" json:"notice,omitempty" yaml:"notice,omitempty"`
+	Remotes        []Remote        `xml:"remote" json:"remotes,omitempty" yaml:"remotes,omitempty"`
+	Default        *Default        `xml:"default" json:"default,omitempty" yaml:"default,omitempty"`
+	ManifestServer *ManifestServer `xml:"manifest-server" json:"manifest-server,omitempty" yaml:"manifest-server,omitempty"`
+	Superproject   *Superproject   `xml:"superproject" json:"superproject,omitempty" yaml:"superproject,omitempty"`
+	ContactInfo    *ContactInfo    `xml:"contactinfo" json:"contactinfo,omitempty" yaml:"contactinfo,omitempty"`
+	Includes       []Include       `xml:"include" json:"includes,omitempty" yaml:"includes,omitempty"`
+	RemoveProjects []RemoveProject `xml:"remove-project" json:"remove-projects,omitempty" yaml:"remove-projects,omitempty"`
+	Projects       []Project       `xml:"project" json:"projects,omitempty" yaml:"projects,omitempty"`
+	ExtendProjects []ExtendProject `xml:"extend-project" json:"extend-projects,omitempty" yaml:"extend-projects,omitempty"`
+	RepoHooks      *RepoHooks      `xml:"repo-hooks" json:"repo-hooks,omitempty" yaml:"repo-hooks,omitempty"`
+
+	index *Index
+}
+
+// Source is the location of an element in a manifest file.
+type Source struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+type Remote struct {
+	Name        string       `xml:"name,attr" json:"name,omitempty" yaml:"name,omitempty"`
+	Alias       string       `xml:"alias,attr,omitempty" json:"alias,omitempty" yaml:"alias,omitempty"`
+	Fetch       string       `xml:"fetch,attr" json:"fetch,omitempty" yaml:"fetch,omitempty"`
+	PushUrl     string       `xml:"pushurl,attr,omitempty" json:"pushurl,omitempty" yaml:"pushurl,omitempty"`
+	Review      string       `xml:"review,attr,omitempty" json:"review,omitempty" yaml:"review,omitempty"`
+	Revision    string       `xml:"revision,attr,omitempty" json:"revision,omitempty" yaml:"revision,omitempty"`
+	Annotations []Annotation `xml:"annotation" json:"annotations,omitempty" yaml:"annotations,omitempty"`
+
+	source Source
+}
+
+type Default struct {
+	Remote     string `xml:"remote,attr,omitempty" json:"remote,omitempty" yaml:"remote,omitempty"`
+	Revision   string `xml:"revision,attr,omitempty" json:"revision,omitempty" yaml:"revision,omitempty"`
+	DestBranch string `xml:"dest-branch,attr,omitempty" json:"dest-branch,omitempty" yaml:"dest-branch,omitempty"`
+	Upstream   string `xml:"upstream,attr,omitempty" json:"upstream,omitempty" yaml:"upstream,omitempty"`
+	SyncJ      string `xml:"sync-j,attr,omitempty" json:"sync-j,omitempty" yaml:"sync-j,omitempty"`
+	SyncC      string `xml:"sync-c,attr,omitempty" json:"sync-c,omitempty" yaml:"sync-c,omitempty"`
+	SyncS      string `xml:"sync-s,attr,omitempty" json:"sync-s,omitempty" yaml:"sync-s,omitempty"`
+	SyncTags   string `xml:"sync-tags,attr,omitempty" json:"sync-tags,omitempty" yaml:"sync-tags,omitempty"`
+
+	source Source
+}
+
+type ManifestServer struct {
+	Url string `xml:"url,attr" json:"url,omitempty" yaml:"url,omitempty"`
+}
+
+type Superproject struct {
+	Name     string `xml:"name,attr" json:"name,omitempty" yaml:"name,omitempty"`
+	Remote   string `xml:"remote,attr,omitempty" json:"remote,omitempty" yaml:"remote,omitempty"`
+	Revision string `xml:"revision,attr,omitempty" json:"revision,omitempty" yaml:"revision,omitempty"`
+}
+
+type ContactInfo struct {
+	BugUrl string `xml:"bugurl,attr" json:"bugurl,omitempty" yaml:"bugurl,omitempty"`
+}
+
+type Include struct {
+	Name     string `xml:"name,attr" json:"name,omitempty" yaml:"name,omitempty"`
+	Groups   string `xml:"groups,attr,omitempty" json:"groups,omitempty" yaml:"groups,omitempty"`
+	Revision string `xml:"revision,attr,omitempty" json:"revision,omitempty" yaml:"revision,omitempty"`
+
+	source Source
+}
+
+type RemoveProject struct {
+	Name     string `xml:"name,attr,omitempty" json:"name,omitempty" yaml:"name,omitempty"`
+	Path     string `xml:"path,attr,omitempty" json:"path,omitempty" yaml:"path,omitempty"`
+	Optional string `xml:"optional,attr,omitempty" json:"optional,omitempty" yaml:"optional,omitempty"`
+	BaseRev  string `xml:"base-rev,attr,omitempty" json:"base-rev,omitempty" yaml:"base-rev,omitempty"`
+
+	source Source
+}
+
+type Project struct {
+	Name        string       `xml:"name,attr" json:"name,omitempty" yaml:"name,omitempty"`
+	Path        string       `xml:"path,attr,omitempty" json:"path,omitempty" yaml:"path,omitempty"`
+	Remote      string       `xml:"remote,attr,omitempty" json:"remote,omitempty" yaml:"remote,omitempty"`
+	Revision    string       `xml:"revision,attr,omitempty" json:"revision,omitempty" yaml:"revision,omitempty"`
+	DestBranch  string       `xml:"dest-branch,attr,omitempty" json:"dest-branch,omitempty" yaml:"dest-branch,omitempty"`
+	Groups      string       `xml:"groups,attr,omitempty" json:"groups,omitempty" yaml:"groups,omitempty"`
+	SyncC       string       `xml:"sync-c,attr,omitempty" json:"sync-c,omitempty" yaml:"sync-c,omitempty"`
+	SyncS       string       `xml:"sync-s,attr,omitempty" json:"sync-s,omitempty" yaml:"sync-s,omitempty"`
+	SyncTags    string       `xml:"sync-tags,attr,omitempty" json:"sync-tags,omitempty" yaml:"sync-tags,omitempty"`
+	Upstream    string       `xml:"upstream,attr,omitempty" json:"upstream,omitempty" yaml:"upstream,omitempty"`
+	CloneDepth  string       `xml:"clone-depth,attr,omitempty" json:"clone-depth,omitempty" yaml:"clone-depth,omitempty"`
+	ForcePath   string       `xml:"force-path,attr,omitempty" json:"force-path,omitempty" yaml:"force-path,omitempty"`
+	Annotations []Annotation `xml:"annotation" json:"annotations,omitempty" yaml:"annotations,omitempty"`
+	CopyFiles   []CopyFile   `xml:"copyfile" json:"copyfiles,omitempty" yaml:"copyfiles,omitempty"`
+	LinkFiles   []LinkFile   `xml:"linkfile" json:"linkfiles,omitempty" yaml:"linkfiles,omitempty"`
+	Projects    []Project    `xml:"project" json:"projects,omitempty" yaml:"projects,omitempty"`
+
+	source Source
 }
 
+type ExtendProject struct {
+	Name       string `xml:"name,attr" json:"name,omitempty" yaml:"name,omitempty"`
+	Path       string `xml:"path,attr,omitempty" json:"path,omitempty" yaml:"path,omitempty"`
+	DestPath   string `xml:"dest-path,attr,omitempty" json:"dest-path,omitempty" yaml:"dest-path,omitempty"`
+	Groups     string `xml:"groups,attr,omitempty" json:"groups,omitempty" yaml:"groups,omitempty"`
+	Revision   string `xml:"revision,attr,omitempty" json:"revision,omitempty" yaml:"revision,omitempty"`
+	Remote     string `xml:"remote,attr,omitempty" json:"remote,omitempty" yaml:"remote,omitempty"`
+	DestBranch string `xml:"dest-branch,attr,omitempty" json:"dest-branch,omitempty" yaml:"dest-branch,omitempty"`
+	Upstream   string `xml:"upstream,attr,omitempty" json:"upstream,omitempty" yaml:"upstream,omitempty"`
+	BaseRev    string `xml:"base-rev,attr,omitempty" json:"base-rev,omitempty" yaml:"base-rev,omitempty"`
+
+	source Source
+}
+
+type Annotation struct {
+	Name  string `xml:"name,attr" json:"name,omitempty" yaml:"name,omitempty"`
+	Value string `xml:"value,attr" json:"value,omitempty" yaml:"value,omitempty"`
+	Keep  string `xml:"keep,attr,omitempty" json:"keep,omitempty" yaml:"keep,omitempty"`
+}
+
+type CopyFile struct {
+	Src  string `xml:"src,attr" json:"src,omitempty" yaml:"src,omitempty"`
+	Dest string `xml:"dest,attr" json:"dest,omitempty" yaml:"dest,omitempty"`
+}
+
+type LinkFile struct {
+	Src  string `xml:"src,attr" json:"src,omitempty" yaml:"src,omitempty"`
+	Dest string `xml:"dest,attr" json:"dest,omitempty" yaml:"dest,omitempty"`
+}
+
+type RepoHooks struct {
+	InProject   string `xml:"in-project,attr" json:"in-project,omitempty" yaml:"in-project,omitempty"`
+	EnabledList string `xml:"enabled-list,attr" json:"enabled-list,omitempty" yaml:"enabled-list,omitempty"`
+}
+
+// Load reads the manifest in name and expands its includes recursively,
+// which are looked up in the manifest repository directory.
 func (m *Manifest) Load(name string) error {
-	buf, err := mxj.NewMapsFromXmlFile(name)
-	if err != nil {
-		return errors.Wrap(err, "load failed")
+	l := loader{
+		dir:  includeDir(name),
+		read: os.ReadFile,
 	}
 
-	if len(buf) != 1 {
-		return errors.Wrap(err, "manifest invalid")
+	n := Manifest{}
+
+	if err := l.load(&n, name, nil); err != nil {
+		return errors.Wrap(err, "load failed")
 	}
 
-	m.manifest = buf
+	*m = n
 
 	return nil
 }
 
-func (m Manifest) Projects() ([]interface{}, error) {
-	if m.manifest == nil || len(m.manifest) != 1 {
-		return nil, errors.New("manifest invalid")
+// Files returns the manifest files read loading name and overlaying it with
+// the local manifests in dir, which are name, the local manifests and all of
+// the manifests they include, in the order read. Dir is skipped if empty.
+func Files(name, dir string) ([]string, error) {
+	var files []string
+
+	seen := map[string]bool{}
+	read := func(name string) ([]byte, error) {
+		if !seen[name] {
+			seen[name] = true
+			files = append(files, name)
+		}
+		return os.ReadFile(name)
 	}
 
-	if _, ok := m.manifest[0]["manifest"]; !ok {
-		return nil, errors.New("manifest invalid")
+	l := loader{
+		dir:  includeDir(name),
+		read: read,
 	}
 
-	if _, ok := m.manifest[0]["manifest"].(map[string]interface{})["project"]; !ok {
-		return nil, errors.New("manifest invalid")
+	m := Manifest{}
+
+	if err := l.load(&m, name, nil); err != nil {
+		return nil, errors.Wrap(err, "load failed")
 	}
 
-	buf := m.manifest[0]["manifest"].(map[string]interface{})["project"]
+	if dir != "" {
+		if err := m.overlay(dir, read); err != nil {
+			return nil, err
+		}
+	}
 
-	return buf.([]interface{}), nil
+	return files, nil
 }
 
-func (m Manifest) Project(data map[string]interface{}) (depth, name, path, revision string, err error) {
-	if m.manifest == nil || len(m.manifest) != 1 {
-		return "", "", "", "", errors.New("manifest invalid")
-	}
+// Project returns the first project of name through the index of m, which is
+// created again once the projects are replaced or renamed.
+func (m *Manifest) Project(name string) (Project, error) {
+	fresh := false
 
-	if _, ok := m.manifest[0]["manifest"]; !ok {
-		return "", "", "", "", errors.New("manifest invalid")
+	if m.index == nil || m.index.stale(m.Projects) {
+		m.index, fresh = NewIndex(m), true
 	}
 
-	if _, ok := m.manifest[0]["manifest"].(map[string]interface{})["default"]; !ok {
-		return "", "", "", "", errors.New("default invalid")
+	p, err := m.index.Project(name)
+	if (err != nil || p.Name != name) && !fresh {
+		m.index = NewIndex(m)
+		p, err = m.index.Project(name)
 	}
 
-	if d, ok := data["-clone-depth"]; ok {
-		depth = d.(string)
-	}
+	return p, err
+}
 
-	if _, ok := data["-name"]; !ok {
-		return depth, "", "", "", errors.New("name invalid")
+// Revision returns the revision of project, falling back to the one of its
+// remote and then the default one.
+func (m Manifest) Revision(p Project) (string, error) {
+	if p.Revision != "" {
+		return p.Revision, nil
 	}
-	name = data["-name"].(string)
 
-	path = name
-	if p, ok := data["-path"]; ok {
-		path = p.(string)
+	if r, err := m.ProjectRemote(p); err == nil && r.Revision != "" {
+		return r.Revision, nil
 	}
 
-	if r, ok := data["-revision"]; ok {
-		revision = r.(string)
-	} else if r, ok := m.manifest[0]["manifest"].(map[string]interface{})["default"].(map[string]interface{})["-revision"]; ok {
-		revision = r.(string)
-	} else {
-		return depth, name, path, "", errors.New("revision invalid")
+	if m.Default != nil && m.Default.Revision != "" {
+		return m.Default.Revision, nil
 	}
 
-	return depth, name, path, revision, nil
+	return "", errors.New("revision invalid")
 }
 
-func (m *Manifest) Update(projects []interface{}) error {
-	if m.manifest == nil || len(m.manifest) != 1 {
-		return errors.New("manifest invalid")
+// Write writes the manifest to name in the format of its extension.
+func (m Manifest) Write(name string) error {
+	buf, err := m.Encode(Format(name))
+	if err != nil {
+		return errors.Wrap(err, "encode failed")
 	}
 
-	if _, ok := m.manifest[0]["manifest"]; !ok {
-		return errors.New("manifest invalid")
+	if err := os.WriteFile(name, buf, perm); err != nil {
+		return errors.Wrap(err, "write failed")
 	}
 
-	if _, ok := m.manifest[0]["manifest"].(map[string]interface{})["project"]; !ok {
-		return errors.New("manifest invalid")
-	}
+	return nil
+}
 
-	m.manifest[0]["manifest"].(map[string]interface{})["project"] = projects
+func (r Remote) Source() Source {
+	return r.source
+}
 
-	return nil
+func (p Project) Source() Source {
+	return p.source
 }
 
-func (m Manifest) Write(name string) error {
-	if err := m.manifest.XmlFileIndent(name, "", "  "); err != nil {
-		return errors.Wrap(err, "write failed")
+func (s Source) String() string {
+	return s.File + ":" + strconv.Itoa(s.Line)
+}
+
+// RelPath returns the path of project relative to the top of the tree.
+func (p Project) RelPath() string {
+	if p.Path != "" {
+		return p.Path
 	}
 
-	return nil
+	return p.Name
+}
+
+// Walk calls fn with every project of m, where nested projects follow their
+// parents, and a copy of it without nested projects whose name and path are
+// joined to the ones of its parents like repo does. Changes fn makes to the
+// projects are kept in m.
+func (m *Manifest) Walk(fn func(p *Project, flat Project)) {
+	walk(m.Projects, nil, fn)
+}
+
+// Flatten returns every project of m with the nested ones, see Walk.
+func (m Manifest) Flatten() []Project {
+	var buf []Project
+
+	walk(m.Projects, nil, func(_ *Project, flat Project) {
+		buf = append(buf, flat)
+	})
+
+	return buf
+}
+
+func walk(projects []Project, parent *Project, fn func(*Project, Project)) {
+	for index := range projects {
+		p := &projects[index]
+		flat := *p
+		flat.Projects = nil
+		if parent != nil {
+			flat.Name = parent.Name + "/" + p.Name
+			flat.Path = parent.RelPath() + "/" + p.RelPath()
+		}
+		fn(p, flat)
+		walk(p.Projects, &flat, fn)
+	}
 }
@@ -14,6 +14,7 @@ package manifest
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -24,16 +25,69 @@ func TestLoad(t *testing.T) {
 
 	err := m.Load("../test/manifest-1.xml")
 	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(m.Remotes))
+	assert.Equal(t, 4, len(m.Projects))
+	assert.Equal(t, "master", m.Default.Revision)
+
+	err = m.Load("../test/manifest-2.xml")
+	assert.Equal(t, nil, err)
+
+	name := filepath.Join(t.TempDir(), "manifest.xml")
+	err = os.WriteFile(name, []byte(`<manifest><project name="platform/art"/></manifest>`), 0600)
+	assert.Equal(t, nil, err)
+
+	err = m.Load(name)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(m.Projects))
+
+	err = os.WriteFile(name, []byte(`<project name="platform/art"/>`), 0600)
+	assert.Equal(t, nil, err)
+
+	err = m.Load(name)
+	assert.NotEqual(t, nil, err)
 }
 
-func TestProjects(t *testing.T) {
-	m := Manifest{}
+func TestFiles(t *testing.T) {
+	dir := t.TempDir()
+	local := filepath.Join(dir, "local_manifests")
 
-	err := m.Load("../test/manifest-1.xml")
+	err := os.MkdirAll(local, 0755)
 	assert.Equal(t, nil, err)
 
-	_, err = m.Projects()
+	err = os.MkdirAll(filepath.Join(local, "extra"), 0755)
 	assert.Equal(t, nil, err)
+
+	files := map[string]string{
+		filepath.Join(dir, "default.xml"):          `<manifest><include name="common.xml"/></manifest>`,
+		filepath.Join(dir, "common.xml"):           `<manifest><project name="platform/art"/></manifest>`,
+		filepath.Join(dir, "unused.xml"):           `<manifest/>`,
+		filepath.Join(local, "local.xml"):          `<manifest><include name="extra/extra.xml"/></manifest>`,
+		filepath.Join(local, "extra", "extra.xml"): `<manifest><project name="platform/build"/></manifest>`,
+		filepath.Join(local, "remove.xml"):         `<manifest><remove-project name="platform/art"/></manifest>`,
+		filepath.Join(local, "readme.txt"):         `none`,
+	}
+
+	for key, val := range files {
+		err = os.WriteFile(key, []byte(val), 0600)
+		assert.Equal(t, nil, err)
+	}
+
+	buf, err := Files(filepath.Join(dir, "default.xml"), "")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{filepath.Join(dir, "default.xml"), filepath.Join(dir, "common.xml")}, buf)
+
+	buf, err = Files(filepath.Join(dir, "default.xml"), local)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "default.xml"),
+		filepath.Join(dir, "common.xml"),
+		filepath.Join(local, "local.xml"),
+		filepath.Join(local, "extra", "extra.xml"),
+		filepath.Join(local, "remove.xml"),
+	}, buf)
+
+	_, err = Files(filepath.Join(dir, "none.xml"), "")
+	assert.NotEqual(t, nil, err)
 }
 
 func TestProject(t *testing.T) {
@@ -42,31 +96,52 @@ func TestProject(t *testing.T) {
 	err := m.Load("../test/manifest-1.xml")
 	assert.Equal(t, nil, err)
 
-	projects, err := m.Projects()
+	p, err := m.Project("platform/build")
 	assert.Equal(t, nil, err)
+	assert.Equal(t, "build/make", p.RelPath())
+	assert.Equal(t, "100", p.CloneDepth)
 
-	for _, val := range projects {
-		_, _, _, _, err := m.Project(val.(map[string]interface{}))
-		assert.Equal(t, nil, err)
-	}
+	_, err = m.Project("platform/invalid")
+	assert.NotEqual(t, nil, err)
+
+	m.Projects = append(m.Projects, Project{Name: "platform/invalid"})
+
+	p, err = m.Project("platform/invalid")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "platform/invalid", p.RelPath())
+
+	m.Projects[len(m.Projects)-1].Name = "platform/renamed"
+
+	_, err = m.Project("platform/invalid")
+	assert.NotEqual(t, nil, err)
+
+	p, err = m.Project("platform/renamed")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "platform/renamed", p.Name)
 }
 
-func TestUpdate(t *testing.T) {
+func TestRevision(t *testing.T) {
 	m := Manifest{}
 
 	err := m.Load("../test/manifest-1.xml")
 	assert.Equal(t, nil, err)
 
-	buf := make([]interface{}, 1)
-
-	buf[0] = map[string]string{
-		"groups": "pdk",
-		"name":   "platform/build",
-		"path":   "build/make",
+	for _, val := range m.Projects {
+		_, err := m.Revision(val)
+		assert.Equal(t, nil, err)
 	}
 
-	err = m.Update(buf)
-	assert.Equal(t, nil, err)
+	p, _ := m.Project("platform/art")
+	rev, _ := m.Revision(p)
+	assert.Equal(t, "android10-release", rev)
+
+	p, _ = m.Project("platform/build")
+	rev, _ = m.Revision(p)
+	assert.Equal(t, "master", rev)
+
+	m.Default = nil
+	_, err = m.Revision(p)
+	assert.NotEqual(t, nil, err)
 }
 
 func TestWrite(t *testing.T) {
@@ -75,8 +150,77 @@ func TestWrite(t *testing.T) {
 	err := m.Load("../test/manifest-1.xml")
 	assert.Equal(t, nil, err)
 
-	err = m.Write("../test/manifest-1-new.xml")
+	m.Projects[0].CloneDepth = "1"
+
+	name := filepath.Join(t.TempDir(), "manifest-1-new.xml")
+
+	err = m.Write(name)
 	assert.Equal(t, nil, err)
 
-	_ = os.RemoveAll("../test/manifest-1-new.xml")
+	n := Manifest{}
+
+	err = n.Load(name)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, len(m.Projects), len(n.Projects))
+	for index := range m.Projects {
+		assert.Equal(t, m.Projects[index].Name, n.Projects[index].Name)
+	}
+	assert.Equal(t, "1", n.Projects[0].CloneDepth)
+}
+
+func TestWalk(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "manifest.xml")
+	err := os.WriteFile(name, []byte(`<manifest>
+  <project name="platform/build" path="build/make" groups="pdk">
+    <project name="blueprint"
+             path="bp">
+      <project name="nested"/>
+    </project>
+    <project name="soong"/>
+  </project>
+  <project name="platform/art"/>
+</manifest>`), 0600)
+	assert.Equal(t, nil, err)
+
+	m := Manifest{}
+
+	err = m.Load(name)
+	assert.Equal(t, nil, err)
+
+	var names, paths []string
+	var lines []int
+
+	m.Walk(func(p *Project, flat Project) {
+		names = append(names, flat.Name)
+		paths = append(paths, flat.Path)
+		lines = append(lines, p.Source().Line)
+		assert.Equal(t, 0, len(flat.Projects))
+		p.Revision = "dev"
+	})
+
+	assert.Equal(t, []string{"platform/build", "platform/build/blueprint", "platform/build/blueprint/nested",
+		"platform/build/soong", "platform/art"}, names)
+	assert.Equal(t, []string{"build/make", "build/make/bp", "build/make/bp/nested", "build/make/soong", ""}, paths)
+	assert.Equal(t, []int{2, 3, 5, 7, 9}, lines)
+	assert.Equal(t, "dev", m.Projects[0].Projects[0].Projects[0].Revision)
+
+	projects := m.Flatten()
+	assert.Equal(t, 5, len(projects))
+	assert.Equal(t, "platform/build/blueprint/nested", projects[2].Name)
+	assert.Equal(t, "build/make/bp/nested", projects[2].RelPath())
+
+	projects = m.Select(Groups("pdk"))
+	assert.Equal(t, 1, len(projects))
+	assert.Equal(t, "platform/build", projects[0].Name)
+
+	projects = m.Select(Groups("all"))
+	assert.Equal(t, 5, len(projects))
+}
+
+func TestRelPath(t *testing.T) {
+	p := Project{Name: "platform/art"}
+	assert.Equal(t, "platform/art", p.RelPath())
+
+	p.Path = "art"
+	assert.Equal(t, "art", p.RelPath())
 }
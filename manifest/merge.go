@@ -0,0 +1,294 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	PolicyFail    = "fail"
+	PolicyHighest = "highest-revision-wins"
+	PolicyLeft    = "prefer-left"
+	PolicyRight   = "prefer-right"
+)
+
+const (
+	chosenLeft  = "left"
+	chosenRight = "right"
+)
+
+// Conflict is a duplicate element found in merging manifests, where Left is
+// the element merged so far, Right the one from the manifest being merged,
+// and Chosen the side kept, which is empty with PolicyFail.
+type Conflict struct {
+	Element string `json:"element"`
+	Name    string `json:"name"`
+	Path    string `json:"path,omitempty"`
+	Left    string `json:"left"`
+	Right   string `json:"right"`
+	Chosen  string `json:"chosen,omitempty"`
+}
+
+// Merge merges manifests from left to right, where projects are duplicate if
+// in the same path and remotes if of the same name. Duplicates which differ,
+// with inherited remote and revision taken into account, are resolved by
+// policy and reported as conflicts, and the result fails with PolicyFail if
+// there is any conflict. Remote and revision inherited from the default of a
+// manifest are set on its projects if the default of the result differs.
+func Merge(policy string, manifests ...*Manifest) (Manifest, []Conflict, error) {
+	var conflicts []Conflict
+
+	switch policy {
+	case PolicyFail, PolicyHighest, PolicyLeft, PolicyRight:
+	default:
+		return Manifest{}, nil, errors.New("policy invalid")
+	}
+
+	if len(manifests) == 0 {
+		return Manifest{}, nil, errors.New("manifest required")
+	}
+
+	m := Manifest{}
+
+	for _, val := range manifests {
+		conflicts = append(conflicts, m.mergeHeader(val, policy)...)
+	}
+
+	for _, val := range manifests {
+		conflicts = append(conflicts, m.mergeProjects(val, policy)...)
+	}
+
+	if policy == PolicyFail && len(conflicts) != 0 {
+		return Manifest{}, conflicts, errors.New("conflict found")
+	}
+
+	return m, conflicts, nil
+}
+
+func (c Conflict) String() string {
+	name := c.Name
+	if c.Path != "" {
+		name += " (" + c.Path + ")"
+	}
+
+	chosen := c.Chosen
+	if chosen == "" {
+		chosen = "none"
+	}
+
+	return fmt.Sprintf("%s %s: left %s, right %s, chosen %s", c.Element, name, OrNone(c.Left), OrNone(c.Right), chosen)
+}
+
+// mergeHeader merges the elements of n other than projects into m.
+func (m *Manifest) mergeHeader(n *Manifest, policy string) []Conflict {
+	var conflicts []Conflict
+
+	for _, val := range n.Remotes {
+		r := val
+		index := -1
+		for i := range m.Remotes {
+			if m.Remotes[i].Name == r.Name {
+				index = i
+			}
+		}
+		if index < 0 {
+			m.Remotes = append(m.Remotes, r)
+			continue
+		}
+		if m.Remotes[index].equal(&r) {
+			continue
+		}
+		c := Conflict{Element: "remote", Name: r.Name, Left: attrs(m.Remotes[index]), Right: attrs(r)}
+		c.Chosen = choose(policy, m.Remotes[index].Revision, r.Revision)
+		if c.Chosen == chosenRight {
+			m.Remotes[index] = r
+		}
+		conflicts = append(conflicts, c)
+	}
+
+	if n.Default != nil {
+		if m.Default == nil {
+			d := *n.Default
+			m.Default = &d
+		} else if !m.Default.equal(n.Default) {
+			c := Conflict{Element: "default", Name: "default", Left: attrs(*m.Default), Right: attrs(*n.Default)}
+			c.Chosen = choose(policy, m.Default.Revision, n.Default.Revision)
+			if c.Chosen == chosenRight {
+				d := *n.Default
+				m.Default = &d
+			}
+			conflicts = append(conflicts, c)
+		}
+	}
+
+	if m.Notice == "" {
+		m.Notice = n.Notice
+	}
+
+	if m.ManifestServer == nil {
+		m.ManifestServer = n.ManifestServer
+	}
+
+	if m.Superproject == nil {
+		m.Superproject = n.Superproject
+	}
+
+	if m.ContactInfo == nil {
+		m.ContactInfo = n.ContactInfo
+	}
+
+	if m.RepoHooks == nil {
+		m.RepoHooks = n.RepoHooks
+	}
+
+	return conflicts
+}
+
+// mergeProjects merges the projects of n into m, which has the header of
+// every manifest merged already.
+func (m *Manifest) mergeProjects(n *Manifest, policy string) []Conflict {
+	var conflicts []Conflict
+
+	paths := map[string]int{}
+
+	for index, val := range m.Projects {
+		paths[val.RelPath()] = index
+	}
+
+	for _, val := range n.Projects {
+		p := m.inherit(n, val)
+		index, ok := paths[p.RelPath()]
+		if !ok {
+			paths[p.RelPath()] = len(m.Projects)
+			m.Projects = append(m.Projects, p)
+			continue
+		}
+		if sameProject(m.effective(m.Projects[index]), m.effective(p)) {
+			continue
+		}
+		left, _ := m.Revision(m.Projects[index])
+		right, _ := m.Revision(p)
+		c := Conflict{Element: "project", Name: p.Name, Path: p.RelPath(),
+			Left: attrs(m.Projects[index]), Right: attrs(p)}
+		c.Chosen = choose(policy, left, right)
+		if c.Chosen == chosenRight {
+			m.Projects[index] = p
+		}
+		conflicts = append(conflicts, c)
+	}
+
+	m.RemoveProjects = append(m.RemoveProjects, n.RemoveProjects...)
+	m.ExtendProjects = append(m.ExtendProjects, n.ExtendProjects...)
+
+	return conflicts
+}
+
+// inherit returns p of n with remote and revision set if the ones inherited
+// in n differ from the ones inherited in m.
+func (m *Manifest) inherit(n *Manifest, p Project) Project {
+	if p.Remote == "" && n.Default != nil {
+		if m.Default == nil || m.Default.Remote != n.Default.Remote {
+			p.Remote = n.Default.Remote
+		}
+	}
+
+	if p.Revision == "" {
+		old, err := n.Revision(p)
+		if rev, _ := m.Revision(p); err == nil && rev != old {
+			p.Revision = old
+		}
+	}
+
+	return p
+}
+
+// effective returns p with the remote and revision inherited in m set.
+func (m *Manifest) effective(p Project) Project {
+	if r, err := m.ProjectRemote(p); err == nil {
+		p.Remote = r.Name
+	}
+
+	if rev, err := m.Revision(p); err == nil {
+		p.Revision = rev
+	}
+
+	return p
+}
+
+// choose returns the side to keep by policy, where revisions of both sides
+// are compared in natural order with PolicyHighest, and left wins a tie.
+func choose(policy, left, right string) string {
+	switch policy {
+	case PolicyLeft:
+		return chosenLeft
+	case PolicyRight:
+		return chosenRight
+	case PolicyHighest:
+		if CompareNatural(right, left) > 0 {
+			return chosenRight
+		}
+		return chosenLeft
+	}
+
+	return ""
+}
+
+// CompareNatural compares a and b with runs of digits compared by value, like
+// android-10.0.0_r9 < android-10.0.0_r10.
+func CompareNatural(a, b string) int {
+	for a != "" && b != "" {
+		x, y := chunk(a), chunk(b)
+		a, b = a[len(x):], b[len(y):]
+		if x == y {
+			continue
+		}
+		i, err1 := strconv.ParseUint(x, 10, 64)
+		j, err2 := strconv.ParseUint(y, 10, 64)
+		if err1 == nil && err2 == nil && i != j {
+			if i < j {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(x, y)
+	}
+
+	return strings.Compare(a, b)
+}
+
+// chunk returns the leading run of digits or non-digits of s.
+func chunk(s string) string {
+	digit := unicode.IsDigit(rune(s[0]))
+
+	for index, val := range s {
+		if unicode.IsDigit(val) != digit {
+			return s[:index]
+		}
+	}
+
+	return s
+}
+
+func sameProject(a, b Project) bool {
+	x, err1 := xml.Marshal(a)
+	y, err2 := xml.Marshal(b)
+
+	return err1 == nil && err2 == nil && string(x) == string(y)
+}
@@ -0,0 +1,121 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newMerge() (*Manifest, *Manifest) {
+	platform := Manifest{
+		Remotes: []Remote{{Name: "aosp", Fetch: ".."}},
+		Default: &Default{Remote: "aosp", Revision: "android-10.0.0_r9"},
+		Projects: []Project{
+			{Name: "platform/art", Path: "art"},
+			{Name: "platform/build", Path: "build/make"},
+		},
+	}
+
+	vendor := Manifest{
+		Remotes: []Remote{{Name: "vendor", Fetch: "https://vendor.example.com"}},
+		Default: &Default{Remote: "vendor", Revision: "main"},
+		Projects: []Project{
+			{Name: "platform/art", Path: "art", Remote: "aosp", Revision: "android-10.0.0_r10"},
+			{Name: "platform/build", Path: "build/make", Remote: "aosp", Revision: "android-10.0.0_r9"},
+			{Name: "vendor/foo", Path: "vendor/foo"},
+		},
+	}
+
+	return &platform, &vendor
+}
+
+func TestMerge(t *testing.T) {
+	platform, vendor := newMerge()
+
+	m, conflicts, err := Merge(PolicyLeft, platform, vendor)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(m.Remotes))
+	assert.Equal(t, "aosp", m.Default.Remote)
+	assert.Equal(t, 3, len(m.Projects))
+	assert.Equal(t, "", m.Projects[0].Revision)
+	assert.Equal(t, Project{Name: "vendor/foo", Path: "vendor/foo", Remote: "vendor", Revision: "main"}, m.Projects[2])
+
+	assert.Equal(t, 2, len(conflicts))
+	assert.Equal(t, "default", conflicts[0].Element)
+	assert.Equal(t, chosenLeft, conflicts[0].Chosen)
+	assert.Equal(t, Conflict{
+		Element: "project",
+		Name:    "platform/art",
+		Path:    "art",
+		Left:    `name="platform/art" path="art"`,
+		Right:   `name="platform/art" path="art" remote="aosp" revision="android-10.0.0_r10"`,
+		Chosen:  chosenLeft,
+	}, conflicts[1])
+	assert.Equal(t, `project platform/art (art): left name="platform/art" path="art", `+
+		`right name="platform/art" path="art" remote="aosp" revision="android-10.0.0_r10", chosen left`,
+		conflicts[1].String())
+
+	m, conflicts, err = Merge(PolicyRight, platform, vendor)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(conflicts))
+	assert.Equal(t, "vendor", m.Default.Remote)
+	assert.Equal(t, "android-10.0.0_r10", m.Projects[0].Revision)
+	assert.Equal(t, "aosp", m.Projects[1].Remote)
+	assert.Equal(t, "android-10.0.0_r9", m.Projects[1].Revision)
+	assert.Equal(t, "", m.Projects[2].Remote)
+
+	m, conflicts, err = Merge(PolicyHighest, platform, vendor)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(conflicts))
+	assert.Equal(t, "vendor", m.Default.Remote)
+	assert.Equal(t, "android-10.0.0_r10", m.Projects[0].Revision)
+
+	_, conflicts, err = Merge(PolicyFail, platform, vendor)
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, 2, len(conflicts))
+	assert.Equal(t, "", conflicts[1].Chosen)
+
+	m, conflicts, err = Merge(PolicyFail, platform, platform)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(conflicts))
+	assert.Equal(t, 2, len(m.Projects))
+
+	_, _, err = Merge("none", platform, vendor)
+	assert.NotEqual(t, nil, err)
+
+	_, _, err = Merge(PolicyLeft)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestMergeRemote(t *testing.T) {
+	a := Manifest{Remotes: []Remote{{Name: "aosp", Fetch: "..", Revision: "v1.2"}}}
+	b := Manifest{Remotes: []Remote{{Name: "aosp", Fetch: "https://android.googlesource.com", Revision: "v1.10"}}}
+
+	m, conflicts, err := Merge(PolicyHighest, &a, &b)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(conflicts))
+	assert.Equal(t, "remote", conflicts[0].Element)
+	assert.Equal(t, chosenRight, conflicts[0].Chosen)
+	assert.Equal(t, "https://android.googlesource.com", m.Remotes[0].Fetch)
+}
+
+func TestCompareNatural(t *testing.T) {
+	assert.Equal(t, -1, CompareNatural("android-10.0.0_r9", "android-10.0.0_r10"))
+	assert.Equal(t, 1, CompareNatural("android-11.0.0_r1", "android-10.0.0_r10"))
+	assert.Equal(t, 0, CompareNatural("main", "main"))
+	assert.Equal(t, -1, CompareNatural("v1", "v1.1"))
+	assert.Equal(t, 1, CompareNatural("v1b", "v1a"))
+	assert.Equal(t, -1, CompareNatural("", "a"))
+}
@@ -0,0 +1,118 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	SHA1 = "^[0-9a-f]{40}$"
+)
+
+const (
+	TypeBranch = "branch"
+	TypeSha    = "sha"
+	TypeTag    = "tag"
+)
+
+var sha1Pattern = regexp.MustCompile(SHA1)
+
+// Query filters projects by the non-empty fields, where Name and Path are
+// regular expressions, Groups is a group list like repo init --groups
+// accepts, Remote is the name of the remote inherited or not, and Type is
+// the type of the revision inherited or not.
+type Query struct {
+	Groups string
+	Name   string
+	Path   string
+	Remote string
+	Type   string
+}
+
+// Entry is a project listed, with its remote and revision resolved.
+type Entry struct {
+	Name       string `json:"name"`
+	Path       string `json:"path"`
+	Remote     string `json:"remote"`
+	Revision   string `json:"revision"`
+	Type       string `json:"type"`
+	Groups     string `json:"groups,omitempty"`
+	Upstream   string `json:"upstream,omitempty"`
+	CloneDepth string `json:"clone-depth,omitempty"`
+}
+
+// RevisionType returns the type of revision, which is TypeSha for SHA1,
+// TypeTag for refs/tags/ and TypeBranch otherwise.
+func RevisionType(revision string) string {
+	switch {
+	case sha1Pattern.MatchString(revision):
+		return TypeSha
+	case strings.HasPrefix(revision, "refs/tags/"):
+		return TypeTag
+	}
+
+	return TypeBranch
+}
+
+// List returns the projects of m matching q in order.
+func (m Manifest) List(q Query) ([]Entry, error) {
+	var buf []Entry
+	var name, path *regexp.Regexp
+	var err error
+
+	if q.Name != "" {
+		if name, err = regexp.Compile(q.Name); err != nil {
+			return nil, errors.Wrap(err, "name invalid")
+		}
+	}
+
+	if q.Path != "" {
+		if path, err = regexp.Compile(q.Path); err != nil {
+			return nil, errors.Wrap(err, "path invalid")
+		}
+	}
+
+	projects := m.Flatten()
+	if q.Groups != "" {
+		projects = m.Select(Groups(q.Groups))
+	}
+
+	for _, val := range projects {
+		e := Entry{
+			Name:       val.Name,
+			Path:       val.RelPath(),
+			Revision:   val.Revision,
+			Groups:     val.Groups,
+			Upstream:   val.Upstream,
+			CloneDepth: val.CloneDepth,
+		}
+		if r, err := m.ProjectRemote(val); err == nil {
+			e.Remote = r.Name
+		}
+		if rev, err := m.Revision(val); err == nil {
+			e.Revision = rev
+		}
+		e.Type = RevisionType(e.Revision)
+		if (name != nil && !name.MatchString(e.Name)) || (path != nil && !path.MatchString(e.Path)) ||
+			(q.Remote != "" && q.Remote != e.Remote) || (q.Type != "" && q.Type != e.Type) {
+			continue
+		}
+		buf = append(buf, e)
+	}
+
+	return buf, nil
+}
@@ -0,0 +1,75 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRevisionType(t *testing.T) {
+	assert.Equal(t, TypeSha, RevisionType(strings.Repeat("a", 40)))
+	assert.Equal(t, TypeBranch, RevisionType(strings.Repeat("A", 40)))
+	assert.Equal(t, TypeTag, RevisionType("refs/tags/android10-release"))
+	assert.Equal(t, TypeBranch, RevisionType("refs/heads/master"))
+	assert.Equal(t, TypeBranch, RevisionType("master"))
+}
+
+func TestList(t *testing.T) {
+	m := Manifest{}
+
+	err := m.Load("../test/manifest-1.xml")
+	assert.Equal(t, nil, err)
+
+	entries, err := m.List(Query{})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 4, len(entries))
+	assert.Equal(t, Entry{
+		Name:       "platform/build",
+		Path:       "build/make",
+		Remote:     "aosp",
+		Revision:   "master",
+		Type:       TypeBranch,
+		Groups:     "pdk",
+		CloneDepth: "100",
+	}, entries[0])
+
+	entries, err = m.List(Query{Groups: "tradefed"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(entries))
+
+	entries, err = m.List(Query{Name: "^platform/build", Path: "soong$"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, TypeSha, entries[0].Type)
+
+	entries, err = m.List(Query{Type: TypeSha})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(entries))
+
+	entries, err = m.List(Query{Remote: "aosp"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 4, len(entries))
+
+	entries, err = m.List(Query{Remote: "github"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(entries))
+
+	_, err = m.List(Query{Name: "("})
+	assert.NotEqual(t, nil, err)
+
+	_, err = m.List(Query{Path: "("})
+	assert.NotEqual(t, nil, err)
+}
@@ -0,0 +1,135 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	schemeFake = "gopher://"
+)
+
+// Endpoint holds where a project is fetched from, reviewed and pushed to,
+// and the revision it is checked out at.
+type Endpoint struct {
+	Name     string `json:"name"`
+	Path     string `json:"path"`
+	Remote   string `json:"remote"`
+	Fetch    string `json:"fetch"`
+	Review   string `json:"review,omitempty"`
+	Push     string `json:"push"`
+	Revision string `json:"revision"`
+}
+
+func (m Manifest) Remote(name string) (Remote, error) {
+	for _, val := range m.Remotes {
+		if val.Name == name {
+			return val, nil
+		}
+	}
+
+	return Remote{}, errors.New("remote not found")
+}
+
+// ProjectRemote returns the remote of project, falling back to the default one.
+func (m Manifest) ProjectRemote(p Project) (Remote, error) {
+	name := p.Remote
+	if name == "" && m.Default != nil {
+		name = m.Default.Remote
+	}
+
+	if name == "" {
+		return Remote{}, errors.New("remote invalid")
+	}
+
+	return m.Remote(name)
+}
+
+// Endpoint resolves the endpoint of project against the manifest repository
+// in manifestUrl, which relative fetch and push URLs of remotes are relative to.
+func (m Manifest) Endpoint(p Project, manifestUrl string) (Endpoint, error) {
+	r, err := m.ProjectRemote(p)
+	if err != nil {
+		return Endpoint{}, errors.Wrap(err, "remote failed")
+	}
+
+	rev, err := m.Revision(p)
+	if err != nil {
+		return Endpoint{}, errors.Wrap(err, "revision failed")
+	}
+
+	fetch, err := resolveUrl(manifestUrl, r.Fetch)
+	if err != nil {
+		return Endpoint{}, errors.Wrap(err, "fetch invalid")
+	}
+
+	push := fetch
+	if r.PushUrl != "" {
+		if push, err = resolveUrl(manifestUrl, r.PushUrl); err != nil {
+			return Endpoint{}, errors.Wrap(err, "pushurl invalid")
+		}
+	}
+
+	name := r.Name
+	if r.Alias != "" {
+		name = r.Alias
+	}
+
+	return Endpoint{
+		Name:     p.Name,
+		Path:     p.RelPath(),
+		Remote:   name,
+		Fetch:    fetch + "/" + p.Name,
+		Review:   r.Review,
+		Push:     push + "/" + p.Name,
+		Revision: rev,
+	}, nil
+}
+
+// resolveUrl resolves ref against base like repo does, where base may have
+// no scheme, e.g. host:port/path, and returns the result without trailing slash.
+func resolveUrl(base, ref string) (string, error) {
+	base = strings.TrimRight(base, "/")
+	ref = strings.TrimRight(ref, "/")
+
+	fake := false
+	if strings.Index(base, ":") != strings.Index(base, "/")-1 {
+		base = schemeFake + base
+		fake = true
+	}
+
+	b, err := url.Parse(base)
+	if err != nil {
+		return "", errors.Wrap(err, "parse failed")
+	}
+
+	r, err := url.Parse(ref)
+	if err != nil {
+		return "", errors.Wrap(err, "parse failed")
+	}
+
+	if !r.IsAbs() && base == schemeFake {
+		return "", errors.New("manifest url required")
+	}
+
+	buf := b.ResolveReference(r).String()
+	if fake {
+		buf = strings.TrimPrefix(buf, schemeFake)
+	}
+
+	return strings.TrimRight(buf, "/"), nil
+}
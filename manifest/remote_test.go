@@ -0,0 +1,141 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	manifestUrl = "https://android.googlesource.com/platform/manifest"
+)
+
+func TestRemote(t *testing.T) {
+	m := Manifest{}
+
+	err := m.Load("../test/manifest-1.xml")
+	assert.Equal(t, nil, err)
+
+	r, err := m.Remote("aosp")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "..", r.Fetch)
+
+	_, err = m.Remote("github")
+	assert.NotEqual(t, nil, err)
+
+	r, err = m.ProjectRemote(m.Projects[0])
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "aosp", r.Name)
+
+	m.Default.Remote = ""
+	_, err = m.ProjectRemote(m.Projects[0])
+	assert.NotEqual(t, nil, err)
+}
+
+func TestEndpoint(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFiles(t, dir, map[string]string{
+		"default.xml": `<manifest>
+  <remote fetch=".." name="aosp" review="https://android-review.googlesource.com/"/>
+  <remote fetch="https://github.com/" name="github" alias="origin" pushurl="ssh://git@github.com" revision="main"/>
+  <remote fetch="/" name="local"/>
+  <default remote="aosp" revision="master"/>
+  <project name="platform/art" path="art"/>
+  <project name="foo/bar" remote="github"/>
+  <project name="foo/baz" remote="github" revision="dev"/>
+</manifest>`,
+	})
+
+	m := Manifest{}
+
+	err := m.Load(filepath.Join(dir, "default.xml"))
+	assert.Equal(t, nil, err)
+
+	e, err := m.Endpoint(m.Projects[0], manifestUrl)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, Endpoint{
+		Name:     "platform/art",
+		Path:     "art",
+		Remote:   "aosp",
+		Fetch:    "https://android.googlesource.com/platform/art",
+		Review:   "https://android-review.googlesource.com/",
+		Push:     "https://android.googlesource.com/platform/art",
+		Revision: "master",
+	}, e)
+
+	e, err = m.Endpoint(m.Projects[1], manifestUrl)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, Endpoint{
+		Name:     "foo/bar",
+		Path:     "foo/bar",
+		Remote:   "origin",
+		Fetch:    "https://github.com/foo/bar",
+		Push:     "ssh://git@github.com/foo/bar",
+		Revision: "main",
+	}, e)
+
+	e, err = m.Endpoint(m.Projects[2], manifestUrl)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "dev", e.Revision)
+
+	_, err = m.Endpoint(Project{Name: "a", Remote: "none"}, manifestUrl)
+	assert.NotEqual(t, nil, err)
+
+	m.Default.Revision = ""
+	_, err = m.Endpoint(m.Projects[0], manifestUrl)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestResolveUrl(t *testing.T) {
+	buf, err := resolveUrl(manifestUrl, "..")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "https://android.googlesource.com", buf)
+
+	buf, err = resolveUrl(manifestUrl+"/", "../..")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "https://android.googlesource.com", buf)
+
+	buf, err = resolveUrl("https://android.googlesource.com/a/platform/manifest", ".")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "https://android.googlesource.com/a/platform", buf)
+
+	buf, err = resolveUrl("localhost:8080/platform/manifest", "..")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "localhost:8080", buf)
+
+	buf, err = resolveUrl(manifestUrl, "https://github.com/")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "https://github.com", buf)
+
+	buf, err = resolveUrl("", "https://github.com")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "https://github.com", buf)
+
+	_, err = resolveUrl("", "..")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestRevisionRemote(t *testing.T) {
+	m := Manifest{
+		Remotes: []Remote{{Name: "aosp", Revision: "main"}},
+		Default: &Default{Remote: "aosp", Revision: "master"},
+	}
+
+	rev, err := m.Revision(Project{Name: "a"})
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "main", rev)
+}
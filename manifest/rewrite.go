@@ -0,0 +1,233 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// Rules is a rules file of rules applied in order.
+type Rules struct {
+	Rules []Rule `json:"rules" yaml:"rules"`
+}
+
+// Rule applies Action to the projects Match selects.
+type Rule struct {
+	Match  Match  `json:"match" yaml:"match"`
+	Action Action `json:"action" yaml:"action"`
+}
+
+// Match selects projects matching all of the non-empty fields, where Name and
+// Path are regular expressions, Groups is a group list like repo init --groups
+// accepts, and Remote is the name of the remote inherited or not.
+type Match struct {
+	Name   string `json:"name,omitempty" yaml:"name,omitempty"`
+	Path   string `json:"path,omitempty" yaml:"path,omitempty"`
+	Groups string `json:"groups,omitempty" yaml:"groups,omitempty"`
+	Remote string `json:"remote,omitempty" yaml:"remote,omitempty"`
+
+	name *regexp.Regexp
+	path *regexp.Regexp
+}
+
+// Action sets the non-empty fields on projects, or removes them if Remove is true.
+type Action struct {
+	Revision     string `json:"revision,omitempty" yaml:"revision,omitempty"`
+	Remote       string `json:"remote,omitempty" yaml:"remote,omitempty"`
+	CloneDepth   string `json:"clone-depth,omitempty" yaml:"clone-depth,omitempty"`
+	Groups       string `json:"groups,omitempty" yaml:"groups,omitempty"`
+	AddGroups    string `json:"add-groups,omitempty" yaml:"add-groups,omitempty"`
+	RemoveGroups string `json:"remove-groups,omitempty" yaml:"remove-groups,omitempty"`
+	Remove       bool   `json:"remove,omitempty" yaml:"remove,omitempty"`
+}
+
+// LoadRules reads the rules file in name in the format of its extension,
+// which is JSON or YAML.
+func LoadRules(name string) (Rules, error) {
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		return Rules{}, errors.Wrap(err, "read failed")
+	}
+
+	return ParseRules(buf, Format(name))
+}
+
+// ParseRules parses the rules in buf of format, and checks them.
+func ParseRules(buf []byte, format string) (Rules, error) {
+	r := Rules{}
+
+	switch format {
+	case FormatJson:
+		d := json.NewDecoder(bytes.NewReader(buf))
+		d.DisallowUnknownFields()
+		if err := d.Decode(&r); err != nil {
+			return Rules{}, errors.Wrap(err, "json invalid")
+		}
+	case FormatYaml:
+		if err := yaml.UnmarshalStrict(buf, &r); err != nil {
+			return Rules{}, errors.Wrap(err, "yaml invalid")
+		}
+	default:
+		return Rules{}, errors.New("format invalid")
+	}
+
+	for index := range r.Rules {
+		if err := r.Rules[index].compile(); err != nil {
+			return Rules{}, errors.Wrap(err, "rule "+strconv.Itoa(index+1)+" invalid")
+		}
+	}
+
+	return r, nil
+}
+
+// Rewrite applies rules to the projects of m in order, including the nested ones.
+func (m *Manifest) Rewrite(rules Rules) error {
+	for index := range rules.Rules {
+		if err := rules.Rules[index].compile(); err != nil {
+			return errors.Wrap(err, "rule "+strconv.Itoa(index+1)+" invalid")
+		}
+		m.Projects = m.rewrite(m.Projects, &rules.Rules[index])
+	}
+
+	return nil
+}
+
+func (m *Manifest) rewrite(projects []Project, r *Rule) []Project {
+	var buf []Project
+
+	for _, val := range projects {
+		if !m.match(val, &r.Match) {
+			val.Projects = m.rewrite(val.Projects, r)
+			buf = append(buf, val)
+			continue
+		}
+		if r.Action.Remove {
+			continue
+		}
+		r.Action.apply(&val)
+		val.Projects = m.rewrite(val.Projects, r)
+		buf = append(buf, val)
+	}
+
+	return buf
+}
+
+func (m *Manifest) match(p Project, s *Match) bool {
+	if s.name != nil && !s.name.MatchString(p.Name) {
+		return false
+	}
+
+	if s.path != nil && !s.path.MatchString(p.RelPath()) {
+		return false
+	}
+
+	if s.Groups != "" && !p.MatchGroups(splitGroups(s.Groups)) {
+		return false
+	}
+
+	if s.Remote != "" {
+		r, err := m.ProjectRemote(p)
+		if err != nil || r.Name != s.Remote {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (r *Rule) compile() error {
+	var err error
+
+	if r.Match.Name != "" {
+		if r.Match.name, err = regexp.Compile(r.Match.Name); err != nil {
+			return errors.Wrap(err, "name invalid")
+		}
+	}
+
+	if r.Match.Path != "" {
+		if r.Match.path, err = regexp.Compile(r.Match.Path); err != nil {
+			return errors.Wrap(err, "path invalid")
+		}
+	}
+
+	a := r.Action
+
+	if !a.Remove && a.Revision == "" && a.Remote == "" && a.CloneDepth == "" &&
+		a.Groups == "" && a.AddGroups == "" && a.RemoveGroups == "" {
+		return errors.New("action required")
+	}
+
+	if a.CloneDepth != "" {
+		if depth, err := strconv.Atoi(a.CloneDepth); err != nil || depth <= 0 {
+			return errors.New("clone-depth invalid")
+		}
+	}
+
+	return nil
+}
+
+func (a *Action) apply(p *Project) {
+	if a.Revision != "" {
+		p.Revision = a.Revision
+	}
+
+	if a.Remote != "" {
+		p.Remote = a.Remote
+	}
+
+	if a.CloneDepth != "" {
+		p.CloneDepth = a.CloneDepth
+	}
+
+	if a.Groups != "" {
+		p.Groups = a.Groups
+	}
+
+	groups := splitGroups(p.Groups)
+
+	for _, val := range splitGroups(a.AddGroups) {
+		if !contains(groups, val) {
+			groups = append(groups, val)
+		}
+	}
+
+	var buf []string
+
+	for _, val := range groups {
+		if !contains(splitGroups(a.RemoveGroups), val) {
+			buf = append(buf, val)
+		}
+	}
+
+	if a.AddGroups != "" || a.RemoveGroups != "" {
+		p.Groups = strings.Join(buf, ",")
+	}
+}
+
+func contains(buf []string, s string) bool {
+	for _, val := range buf {
+		if val == s {
+			return true
+		}
+	}
+
+	return false
+}
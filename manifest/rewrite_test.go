@@ -0,0 +1,117 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newRewrite() Manifest {
+	return Manifest{
+		Remotes: []Remote{{Name: "aosp", Fetch: ".."}, {Name: "mirror", Fetch: "https://mirror.example.com"}},
+		Default: &Default{Remote: "aosp", Revision: "master"},
+		Projects: []Project{
+			{Name: "platform/external/zlib", Path: "external/zlib", Groups: "pdk"},
+			{Name: "platform/tests", Path: "tests", Groups: "tests"},
+			{Name: "vendor/foo", Path: "vendor/foo", Remote: "mirror", Projects: []Project{
+				{Name: "vendor/foo/bar", Path: "bar", Groups: "pdk,tests"},
+			}},
+		},
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	rules, err := ParseRules([]byte(`rules:
+- match:
+    path: ^vendor/
+  action:
+    revision: v1
+- match:
+    groups: tests
+  action:
+    remove-groups: tests
+    add-groups: cts
+- match:
+    name: ^platform/tests$
+  action:
+    remove: true
+- match:
+    name: ^platform/external/
+    remote: aosp
+  action:
+    remote: mirror
+    clone-depth: "1"
+- match:
+    remote: mirror
+    groups: pdk
+  action:
+    groups: mirrored
+`), FormatYaml)
+	assert.Equal(t, nil, err)
+
+	m := newRewrite()
+
+	err = m.Rewrite(rules)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(m.Projects))
+	assert.Equal(t, Project{Name: "platform/external/zlib", Path: "external/zlib", Remote: "mirror",
+		CloneDepth: "1", Groups: "mirrored"}, m.Projects[0])
+	assert.Equal(t, "v1", m.Projects[1].Revision)
+	assert.Equal(t, "", m.Projects[1].Projects[0].Revision)
+	assert.Equal(t, "pdk,cts", m.Projects[1].Projects[0].Groups)
+
+	err = m.Rewrite(Rules{Rules: []Rule{{Match: Match{Name: "("}, Action: Action{Remove: true}}}})
+	assert.NotEqual(t, nil, err)
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules([]byte(`{"rules":[{"match":{"path":"^vendor/"},"action":{"revision":"v1"}}]}`), FormatJson)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 1, len(rules.Rules))
+
+	_, err = ParseRules([]byte(`{"rules":[{"match":{"path":"^vendor/"},"action":{}}]}`), FormatJson)
+	assert.NotEqual(t, nil, err)
+
+	_, err = ParseRules([]byte(`{"rules":[{"match":{"path":"("},"action":{"remove":true}}]}`), FormatJson)
+	assert.NotEqual(t, nil, err)
+
+	_, err = ParseRules([]byte(`{"rules":[{"match":{},"action":{"clone-depth":"0"}}]}`), FormatJson)
+	assert.NotEqual(t, nil, err)
+
+	_, err = ParseRules([]byte(`{"rules":[{"match":{"label":"a"},"action":{"remove":true}}]}`), FormatJson)
+	assert.NotEqual(t, nil, err)
+
+	_, err = ParseRules([]byte("rules:\n- match: {}\n  actions: {}\n"), FormatYaml)
+	assert.NotEqual(t, nil, err)
+
+	_, err = ParseRules(nil, FormatXml)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestLoadRules(t *testing.T) {
+	dir := t.TempDir()
+
+	writeFiles(t, dir, map[string]string{
+		"rules.yml": "rules:\n- match:\n    groups: tests\n  action:\n    remove: true\n",
+	})
+
+	rules, err := LoadRules(filepath.Join(dir, "rules.yml"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, rules.Rules[0].Action.Remove)
+
+	_, err = LoadRules(filepath.Join(dir, "none.yml"))
+	assert.NotEqual(t, nil, err)
+}
@@ -0,0 +1,371 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	Error   = "error"
+	Warning = "warning"
+)
+
+const (
+	ruleCloneDepth = "clone-depth"
+	ruleCopyFile   = "copyfile"
+	ruleDuplicate  = "duplicate"
+	ruleExtend     = "extend-project"
+	ruleInclude    = "include"
+	ruleLinkFile   = "linkfile"
+	ruleNested     = "nested-path"
+	ruleRemote     = "remote"
+	ruleRemove     = "remove-project"
+	ruleRevision   = "revision"
+	ruleUnknown    = "unknown"
+)
+
+// Violation is a problem found in a manifest, which is also returned as
+// error by Load if its severity is Error.
+type Violation struct {
+	Source
+	Severity string `json:"severity"`
+	Rule     string `json:"rule"`
+	Message  string `json:"message"`
+}
+
+// schema holds the attributes and children allowed for an element, where
+// attributes are mapped to their order, and children to the slots they go to
+// in the canonical form, both like the fields of the type of the element.
+type schema struct {
+	attrs    map[string]int
+	children map[string]*schema
+	slots    map[string]int
+	text     bool
+}
+
+var manifestSchema = newSchema(reflect.TypeOf(Manifest{}), map[reflect.Type]*schema{})
+
+// Validate loads the manifest in name like Load does, and reports every
+// violation found instead of failing on the first one.
+func Validate(name string) ([]Violation, error) {
+	var violations []Violation
+
+	l := loader{
+		dir:        includeDir(name),
+		read:       os.ReadFile,
+		violations: &violations,
+	}
+
+	m := Manifest{}
+
+	if err := l.load(&m, name, nil); err != nil {
+		return nil, errors.Wrap(err, "load failed")
+	}
+
+	violations = append(violations, m.check(name)...)
+
+	sort.SliceStable(violations, func(i, j int) bool {
+		if violations[i].File != violations[j].File {
+			return violations[i].File < violations[j].File
+		}
+		return violations[i].Line < violations[j].Line
+	})
+
+	return violations, nil
+}
+
+func (v Violation) Error() string {
+	return v.Source.String() + ": " + v.Message
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s: %s [%s]", v.Source, v.Severity, v.Message, v.Rule)
+}
+
+func newViolation(s Source, severity, rule, format string, args ...interface{}) Violation {
+	return Violation{
+		Source:   s,
+		Severity: severity,
+		Rule:     rule,
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+func (m Manifest) check(name string) []Violation {
+	var violations []Violation
+
+	var projects []Project
+
+	walkProjects(m.Projects, func(p *Project) {
+		projects = append(projects, *p)
+	})
+
+	violations = append(violations, checkNames(projects)...)
+	violations = append(violations, checkPaths(projects)...)
+	violations = append(violations, m.checkRemotes(projects)...)
+	violations = append(violations, m.checkRevisions(name, projects)...)
+
+	for _, val := range projects {
+		violations = append(violations, checkProject(val)...)
+	}
+
+	return violations
+}
+
+func checkNames(projects []Project) []Violation {
+	var violations []Violation
+
+	names := map[string]Project{}
+
+	for _, val := range projects {
+		if p, ok := names[val.Name]; ok {
+			violations = append(violations, newViolation(val.source, Warning, ruleDuplicate,
+				"project %s duplicated (first defined at %s)", val.Name, p.source))
+			continue
+		}
+		names[val.Name] = val
+	}
+
+	return violations
+}
+
+func checkPaths(projects []Project) []Violation {
+	var violations []Violation
+
+	paths := map[string]Project{}
+
+	for _, val := range projects {
+		paths[path.Clean(val.RelPath())] = val
+	}
+
+	for _, val := range projects {
+		for dir := path.Dir(path.Clean(val.RelPath())); dir != "." && dir != "/"; dir = path.Dir(dir) {
+			if p, ok := paths[dir]; ok {
+				violations = append(violations, newViolation(val.source, Warning, ruleNested,
+					"project %s path %s nested in project %s", val.Name, val.RelPath(), p.Name))
+				break
+			}
+		}
+	}
+
+	return violations
+}
+
+func (m Manifest) checkRemotes(projects []Project) []Violation {
+	var violations []Violation
+
+	remotes := map[string]bool{}
+
+	for _, val := range m.Remotes {
+		remotes[val.Name] = true
+	}
+
+	if m.Default != nil && m.Default.Remote != "" && !remotes[m.Default.Remote] {
+		violations = append(violations, newViolation(m.Default.source, Error, ruleRemote,
+			"default remote %s undefined", m.Default.Remote))
+	}
+
+	for _, val := range projects {
+		remote := val.Remote
+		if remote == "" && m.Default != nil {
+			remote = m.Default.Remote
+		}
+		if remote == "" {
+			violations = append(violations, newViolation(val.source, Error, ruleRemote,
+				"project %s remote missing", val.Name))
+		} else if val.Remote != "" && !remotes[remote] {
+			violations = append(violations, newViolation(val.source, Error, ruleRemote,
+				"project %s remote %s undefined", val.Name, remote))
+		}
+	}
+
+	return violations
+}
+
+func (m Manifest) checkRevisions(name string, projects []Project) []Violation {
+	var violations []Violation
+
+	if m.Default != nil && m.Default.Revision != "" {
+		return nil
+	}
+
+	s := Source{File: name}
+	if m.Default != nil {
+		s = m.Default.source
+	}
+
+	violations = append(violations, newViolation(s, Warning, ruleRevision, "default revision missing"))
+
+	for _, val := range projects {
+		if _, err := m.Revision(val); err != nil {
+			violations = append(violations, newViolation(val.source, Error, ruleRevision,
+				"project %s revision missing", val.Name))
+		}
+	}
+
+	return violations
+}
+
+func checkProject(p Project) []Violation {
+	var violations []Violation
+
+	if p.CloneDepth != "" {
+		if depth, err := strconv.Atoi(p.CloneDepth); err != nil || depth <= 0 {
+			violations = append(violations, newViolation(p.source, Error, ruleCloneDepth,
+				"project %s clone-depth %s invalid", p.Name, p.CloneDepth))
+		}
+	}
+
+	for _, val := range p.CopyFiles {
+		if escaped(val.Src) || escaped(val.Dest) {
+			violations = append(violations, newViolation(p.source, Error, ruleCopyFile,
+				"project %s copyfile %s -> %s escapes the tree", p.Name, val.Src, val.Dest))
+		}
+	}
+
+	for _, val := range p.LinkFiles {
+		if escaped(val.Src) || escaped(val.Dest) {
+			violations = append(violations, newViolation(p.source, Error, ruleLinkFile,
+				"project %s linkfile %s -> %s escapes the tree", p.Name, val.Src, val.Dest))
+		}
+	}
+
+	return violations
+}
+
+// escaped returns true if name is empty, absolute or outside of its parent.
+func escaped(name string) bool {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if name == "" || path.IsAbs(name) {
+		return true
+	}
+
+	name = path.Clean(name)
+
+	return name == ".." || strings.HasPrefix(name, "../")
+}
+
+func walkProjects(projects []Project, fn func(*Project)) {
+	for index := range projects {
+		fn(&projects[index])
+		walkProjects(projects[index].Projects, fn)
+	}
+}
+
+// checkSchema reports elements and attributes in the manifest buf which are
+// unknown to the model.
+func checkSchema(name string, buf []byte) []Violation {
+	var violations []Violation
+
+	var stack []*schema
+
+	lines := newLineIndex(buf)
+	d := xml.NewDecoder(bytes.NewReader(buf))
+
+	for {
+		offset := d.InputOffset()
+		token, err := d.Token()
+		if err != nil {
+			break
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			source := Source{File: name, Line: lines.line(offset)}
+			s := manifestSchema
+			if len(stack) != 0 {
+				s = stack[len(stack)-1].children[t.Name.Local]
+			}
+			if s == nil {
+				violations = append(violations, newViolation(source, Warning, ruleUnknown,
+					"element %s unknown", t.Name.Local))
+				_ = d.Skip()
+				continue
+			}
+			for _, val := range t.Attr {
+				if _, ok := s.attrs[val.Name.Local]; val.Name.Space == "" && !ok {
+					violations = append(violations, newViolation(source, Warning, ruleUnknown,
+						"attribute %s of element %s unknown", val.Name.Local, t.Name.Local))
+				}
+			}
+			stack = append(stack, s)
+		case xml.EndElement:
+			if len(stack) != 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+
+	return violations
+}
+
+func newSchema(t reflect.Type, cache map[reflect.Type]*schema) *schema {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+
+	if s, ok := cache[t]; ok {
+		return s
+	}
+
+	s := &schema{
+		attrs:    map[string]int{},
+		children: map[string]*schema{},
+		slots:    map[string]int{},
+		text:     t.Kind() == reflect.String,
+	}
+
+	cache[t] = s
+
+	if t.Kind() != reflect.Struct {
+		return s
+	}
+
+	slot, shared := -1, -1
+
+	for i := 0; i < t.NumField(); i++ {
+		tag := strings.Split(t.Field(i).Tag.Get("xml"), ",")
+		if tag[0] == "" || tag[0] == "-" || t.Field(i).Type == reflect.TypeOf(xml.Name{}) {
+			continue
+		}
+		if len(tag) > 1 && tag[1] == "attr" {
+			s.attrs[tag[0]] = len(s.attrs)
+			continue
+		}
+		s.children[tag[0]] = newSchema(t.Field(i).Type, cache)
+		switch {
+		case ordered[tag[0]] && shared >= 0:
+			s.slots[tag[0]] = shared
+		case ordered[tag[0]]:
+			slot++
+			shared = slot
+			s.slots[tag[0]] = slot
+		default:
+			slot++
+			s.slots[tag[0]] = slot
+		}
+	}
+
+	return s
+}
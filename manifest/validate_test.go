@@ -0,0 +1,94 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package manifest
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidate(t *testing.T) {
+	violations, err := Validate("../test/manifest-1.xml")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(violations))
+
+	violations, err = Validate("../test/manifest-2.xml")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(violations))
+
+	dir := t.TempDir()
+
+	writeFiles(t, dir, map[string]string{
+		"default.xml": `<manifest>
+  <remote fetch=".." name="aosp"/>
+  <remote fetch="/" name="aosp"/>
+  <default remote="aosp" sync-x="1"/>
+  <project name="a" path="x" revision="master"/>
+  <project name="b" path="x" revision="master"/>
+  <project name="a" path="y" revision="master"/>
+  <project name="c" path="y/z" revision="master" clone-depth="0"/>
+  <project name="d" remote="none" revision="master" clone-depth="x"/>
+  <project name="e">
+    <copyfile src="a" dest="../b"/>
+    <linkfile src="/a" dest="b"/>
+    <foo/>
+  </project>
+  <include name="none.xml"/>
+  <foo/>
+</manifest>`,
+	})
+
+	violations, err = Validate(filepath.Join(dir, "default.xml"))
+	assert.Equal(t, nil, err)
+
+	rules := map[string]int{}
+	for _, val := range violations {
+		rules[val.Rule]++
+		assert.Equal(t, filepath.Join(dir, "default.xml"), val.File)
+	}
+
+	assert.Equal(t, 3, rules[ruleDuplicate])
+	assert.Equal(t, 1, rules[ruleNested])
+	assert.Equal(t, 2, rules[ruleCloneDepth])
+	assert.Equal(t, 1, rules[ruleCopyFile])
+	assert.Equal(t, 1, rules[ruleLinkFile])
+	assert.Equal(t, 1, rules[ruleInclude])
+	assert.Equal(t, 1, rules[ruleRemote])
+	assert.Equal(t, 2, rules[ruleRevision])
+	assert.Equal(t, 3, rules[ruleUnknown])
+
+	assert.Equal(t, 3, violations[0].Line)
+	assert.Equal(t, Error, violations[0].Severity)
+	assert.Equal(t, ruleDuplicate, violations[0].Rule)
+
+	_, err = Validate(filepath.Join(dir, "none.xml"))
+	assert.NotEqual(t, nil, err)
+}
+
+func TestViolation(t *testing.T) {
+	v := newViolation(Source{File: "default.xml", Line: 1}, Error, ruleRemote, "remote %s undefined", "aosp")
+	assert.Equal(t, "default.xml:1: remote aosp undefined", v.Error())
+	assert.Equal(t, "default.xml:1: error: remote aosp undefined [remote]", v.String())
+}
+
+func TestEscaped(t *testing.T) {
+	assert.Equal(t, false, escaped("a/b"))
+	assert.Equal(t, false, escaped("a/../b"))
+	assert.Equal(t, true, escaped(""))
+	assert.Equal(t, true, escaped("/a"))
+	assert.Equal(t, true, escaped(".."))
+	assert.Equal(t, true, escaped("a/../../b"))
+	assert.Equal(t, true, escaped("..\\b"))
+}
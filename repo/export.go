@@ -0,0 +1,273 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"gorepo/config"
+	"gorepo/gitiles"
+	"gorepo/manifest"
+)
+
+// Export downloads the archive of every project selected by groups in
+// manifest name, which is loaded by LoadManifest and overlaid with local
+// manifests if local, at its revision via Gitiles, and unpacks it into the
+// project path under dir in up to jobs goroutines. Copyfiles and linkfiles
+// are applied once all projects are unpacked.
+func (r Repo) Export(name, dir, groups string, jobs int, c *config.Gitiles) error {
+	var failed []string
+	var mutex sync.Mutex
+
+	m, err := r.LoadManifest(name, c)
+	if err != nil {
+		return errors.Wrap(err, "load failed")
+	}
+
+	if !r.IsGitiles(name) {
+		if err := m.Overlay(manifest.LocalDir(name)); err != nil {
+			return errors.Wrap(err, "overlay failed")
+		}
+	}
+
+	g := gitiles.Gitiles{}
+
+	if err := g.Init(c.Url, c.User, c.Pass); err != nil {
+		return errors.Wrap(err, "init failed")
+	}
+
+	projects := m.Select(manifest.Groups(groups))
+	u := r.manifestOrigin(name, c)
+
+	r.parallel(len(projects), jobs, func(index int) {
+		project := r.gitilesName(&m, projects[index], u, c)
+		if err := r.exportProject(&g, &m, projects[index], project, dir); err != nil {
+			mutex.Lock()
+			failed = append(failed, projects[index].Name+": "+err.Error())
+			mutex.Unlock()
+		}
+	})
+
+	if len(failed) != 0 {
+		sort.Strings(failed)
+		return errors.New(strings.Join(failed, "; "))
+	}
+
+	for _, val := range projects {
+		if err := r.exportFiles(val, dir); err != nil {
+			return errors.Wrap(err, val.Name+" failed")
+		}
+	}
+
+	return nil
+}
+
+// exportProject unpacks the archive of p, which is project on Gitiles, into
+// its path under dir.
+func (r Repo) exportProject(g *gitiles.Gitiles, m *manifest.Manifest, p manifest.Project, project, dir string) error {
+	rev, err := m.Revision(p)
+	if err != nil {
+		return errors.Wrap(err, "revision failed")
+	}
+
+	path, err := r.securePath(dir, p.RelPath())
+	if err != nil {
+		return err
+	}
+
+	rc, err := g.Archive(project, rev)
+	if err != nil {
+		return errors.Wrap(err, "archive failed")
+	}
+
+	defer func() {
+		_ = rc.Close()
+	}()
+
+	if err := r.untar(rc, path); err != nil {
+		return errors.Wrap(err, "untar failed")
+	}
+
+	return nil
+}
+
+// exportFiles applies the copyfiles and linkfiles of p unpacked under dir,
+// which are relative to the path of p and dir respectively.
+func (r Repo) exportFiles(p manifest.Project, dir string) error {
+	path, err := r.securePath(dir, p.RelPath())
+	if err != nil {
+		return err
+	}
+
+	for _, val := range p.CopyFiles {
+		src, err := r.securePath(path, val.Src)
+		if err != nil {
+			return err
+		}
+		dest, err := r.securePath(dir, val.Dest)
+		if err != nil {
+			return err
+		}
+		if info, err := os.Lstat(src); err != nil || !info.Mode().IsRegular() {
+			return errors.New("copyfile " + val.Src + " invalid")
+		}
+		f, err := os.Open(src)
+		if err != nil {
+			return errors.Wrap(err, "copyfile failed")
+		}
+		err = r.writeFile(dest, f, 0644)
+		_ = f.Close()
+		if err != nil {
+			return errors.Wrap(err, "copyfile failed")
+		}
+	}
+
+	for _, val := range p.LinkFiles {
+		src, err := r.securePath(path, val.Src)
+		if err != nil {
+			return err
+		}
+		dest, err := r.securePath(dir, val.Dest)
+		if err != nil {
+			return err
+		}
+		link, err := filepath.Rel(filepath.Dir(dest), src)
+		if err != nil {
+			return errors.Wrap(err, "linkfile failed")
+		}
+		if err := r.symlink(link, dest); err != nil {
+			return errors.Wrap(err, "linkfile failed")
+		}
+	}
+
+	return nil
+}
+
+// untar unpacks the gzipped tarball in reader into dir, failing on entries
+// outside of dir or written through symlinks.
+func (r Repo) untar(reader io.Reader, dir string) error {
+	gz, err := gzip.NewReader(reader)
+	if err != nil {
+		return errors.Wrap(err, "gzip failed")
+	}
+
+	defer func() {
+		_ = gz.Close()
+	}()
+
+	if info, err := os.Lstat(dir); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return errors.New("path " + dir + " invalid")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrap(err, "mkdir failed")
+	}
+
+	t := tar.NewReader(gz)
+
+	for {
+		h, err := t.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return errors.Wrap(err, "tar failed")
+		}
+		path, err := r.securePath(dir, h.Name)
+		if err != nil {
+			return err
+		}
+		switch h.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, 0755)
+		case tar.TypeReg:
+			err = r.writeFile(path, t, h.FileInfo().Mode().Perm())
+		case tar.TypeSymlink:
+			err = r.symlink(h.Linkname, path)
+		}
+		if err != nil {
+			return errors.Wrap(err, "write failed")
+		}
+	}
+}
+
+// securePath returns name joined to dir, failing if it is outside of dir or
+// any directory between is a symlink.
+func (r Repo) securePath(dir, name string) (string, error) {
+	dir = filepath.Clean(dir)
+
+	if filepath.IsAbs(name) {
+		return "", errors.New("path " + name + " invalid")
+	}
+
+	path := filepath.Join(dir, name)
+
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.New("path " + name + " invalid")
+	}
+
+	for parent := filepath.Dir(path); len(parent) > len(dir); parent = filepath.Dir(parent) {
+		if info, err := os.Lstat(parent); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return "", errors.New("path " + name + " invalid")
+		}
+	}
+
+	return path, nil
+}
+
+// writeFile writes reader to name in mode, replacing name instead of writing
+// through it if it is a symlink.
+// nolint: gosec
+func (r Repo) writeFile(name string, reader io.Reader, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(f, reader); err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+func (r Repo) symlink(link, name string) error {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	if err := os.Remove(name); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return os.Symlink(link, name)
+}
@@ -0,0 +1,233 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gorepo/config"
+)
+
+type entry struct {
+	name string
+	body string
+	link string
+	mode int64
+}
+
+func newArchive(entries ...entry) []byte {
+	var buf bytes.Buffer
+
+	gz := gzip.NewWriter(&buf)
+	t := tar.NewWriter(gz)
+
+	for _, val := range entries {
+		h := &tar.Header{Name: val.name, Mode: val.mode, Size: int64(len(val.body)), Typeflag: tar.TypeReg}
+		switch {
+		case val.link != "":
+			h.Typeflag, h.Linkname, h.Size = tar.TypeSymlink, val.link, 0
+		case val.name[len(val.name)-1] == '/':
+			h.Typeflag = tar.TypeDir
+		}
+		_ = t.WriteHeader(h)
+		_, _ = t.Write([]byte(val.body))
+	}
+
+	_ = t.Close()
+	_ = gz.Close()
+
+	return buf.Bytes()
+}
+
+func newArchives() *httptest.Server {
+	archives := map[string][]byte{
+		"/platform/build/+archive/master.tar.gz": newArchive(
+			entry{name: "core/", mode: 0755},
+			entry{name: "core/envsetup.sh", body: "#!/bin/sh\n", mode: 0755},
+			entry{name: "core/Makefile", body: "all:\n", mode: 0644},
+			entry{name: "core/main.mk", link: "Makefile"},
+		),
+		"/platform/art/+archive/android10-release.tar.gz": newArchive(
+			entry{name: "README", body: "art\n", mode: 0644},
+		),
+		"/platform/evil/+archive/master.tar.gz": newArchive(
+			entry{name: "../../evil", body: "evil\n", mode: 0644},
+		),
+		"/platform/link/+archive/master.tar.gz": newArchive(
+			entry{name: "out", link: "/tmp"},
+			entry{name: "out/evil", body: "evil\n", mode: 0644},
+		),
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, ok := archives[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(buf)
+	}))
+}
+
+func TestExport(t *testing.T) {
+	s := newArchives()
+	defer s.Close()
+
+	c := config.Gitiles{
+		Pass: "",
+		Url:  s.URL,
+		User: "",
+	}
+
+	dir := t.TempDir()
+
+	name := filepath.Join(dir, "manifest.xml")
+	err := os.WriteFile(name, []byte(`<manifest>
+  <default revision="master"/>
+  <project name="platform/build" path="build/make" groups="pdk">
+    <copyfile src="core/Makefile" dest="Makefile"/>
+    <linkfile src="core/envsetup.sh" dest="build/envsetup.sh"/>
+  </project>
+  <project name="platform/art" revision="android10-release"/>
+</manifest>`), 0600)
+	assert.Equal(t, nil, err)
+
+	r := Repo{}
+
+	output := filepath.Join(dir, "out")
+
+	err = r.Export(name, output, "", 2, &c)
+	assert.Equal(t, nil, err)
+
+	buf, err := os.ReadFile(filepath.Join(output, "build/make/core/Makefile"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "all:\n", string(buf))
+
+	info, err := os.Stat(filepath.Join(output, "build/make/core/envsetup.sh"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, os.FileMode(0755), info.Mode().Perm())
+
+	link, err := os.Readlink(filepath.Join(output, "build/make/core/main.mk"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "Makefile", link)
+
+	buf, err = os.ReadFile(filepath.Join(output, "platform/art/README"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "art\n", string(buf))
+
+	buf, err = os.ReadFile(filepath.Join(output, "Makefile"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "all:\n", string(buf))
+
+	link, err = os.Readlink(filepath.Join(output, "build/envsetup.sh"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "make/core/envsetup.sh", link)
+
+	err = r.Export(name, output, "pdk", 1, &c)
+	assert.Equal(t, nil, err)
+
+	output = filepath.Join(dir, "pdk")
+
+	err = r.Export(name, output, "pdk", 1, &c)
+	assert.Equal(t, nil, err)
+
+	_, err = os.Stat(filepath.Join(output, "platform/art"))
+	assert.Equal(t, true, os.IsNotExist(err))
+
+	err = r.Export(filepath.Join(dir, "none.xml"), output, "", 1, &c)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestExportTraversal(t *testing.T) {
+	s := newArchives()
+	defer s.Close()
+
+	c := config.Gitiles{
+		Pass: "",
+		Url:  s.URL,
+		User: "",
+	}
+
+	dir := t.TempDir()
+	output := filepath.Join(dir, "a", "out")
+	r := Repo{}
+
+	for _, val := range []string{
+		`<project name="platform/evil" path="evil"/>`,
+		`<project name="platform/link" path="link"/>`,
+		`<project name="platform/art" path="../art" revision="android10-release"/>`,
+		`<project name="platform/build" path="build"><copyfile src="../../../etc/passwd" dest="passwd"/></project>`,
+		`<project name="platform/build" path="build"><linkfile src="core/Makefile" dest="../Makefile"/></project>`,
+		`<project name="platform/build" path="build"><copyfile src="core/main.mk" dest="main.mk"/></project>`,
+		`<project name="platform/none" path="none"/>`,
+	} {
+		name := filepath.Join(dir, "manifest.xml")
+		err := os.WriteFile(name, []byte(`<manifest><default revision="master"/>`+val+`</manifest>`), 0600)
+		assert.Equal(t, nil, err)
+		err = r.Export(name, output, "", 1, &c)
+		assert.NotEqual(t, nil, err, val)
+	}
+
+	_, err := os.Stat(filepath.Join(dir, "evil"))
+	assert.Equal(t, true, os.IsNotExist(err))
+
+	_, err = os.Stat(filepath.Join(dir, "a", "Makefile"))
+	assert.Equal(t, true, os.IsNotExist(err))
+
+	_, err = os.Stat("/tmp/evil")
+	assert.Equal(t, true, os.IsNotExist(err))
+}
+
+func TestSecurePath(t *testing.T) {
+	dir := t.TempDir()
+	r := Repo{}
+
+	path, err := r.securePath(dir, "a/b")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, filepath.Join(dir, "a", "b"), path)
+
+	path, err = r.securePath(dir, "a/../b")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, filepath.Join(dir, "b"), path)
+
+	path, err = r.securePath(dir, "./")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, dir, path)
+
+	_, err = r.securePath(dir, "../b")
+	assert.NotEqual(t, nil, err)
+
+	_, err = r.securePath(dir, "/etc/passwd")
+	assert.NotEqual(t, nil, err)
+
+	err = os.Symlink("/tmp", filepath.Join(dir, "link"))
+	assert.Equal(t, nil, err)
+
+	_, err = r.securePath(dir, "link")
+	assert.Equal(t, nil, err)
+
+	_, err = r.securePath(dir, "link/a")
+	assert.NotEqual(t, nil, err)
+
+	_, err = r.securePath(dir, "..link/a")
+	assert.Equal(t, nil, err)
+}
@@ -0,0 +1,235 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"gorepo/manifest"
+)
+
+const (
+	gitDir  = ".git"
+	repoDir = ".repo"
+)
+
+var scpPattern = regexp.MustCompile(`^(?:([^@/]+)@)?([^:/]+):(.+)$`)
+
+// checkout is a git repository found in a tree.
+type checkout struct {
+	path   string
+	fetch  string
+	name   string
+	commit string
+	branch string
+}
+
+// Generate walks dir for git repositories, and returns a manifest with their
+// remote URLs grouped by host into remotes, and HEADs pinned as revisions with
+// the branches checked out kept in upstream. The remote used the most is the
+// default one, and repositories without remotes are skipped, as is dir itself
+// since a project cannot be at the root of the tree.
+func (r Repo) Generate(dir string) (manifest.Manifest, error) {
+	var checkouts []checkout
+	var skipped []string
+
+	err := filepath.Walk(dir, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if info.Name() == gitDir || info.Name() == repoDir {
+			return filepath.SkipDir
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		if _, err := os.Stat(filepath.Join(name, gitDir)); err != nil {
+			return nil
+		}
+		c, err := r.checkout(name, filepath.ToSlash(rel))
+		if err != nil {
+			skipped = append(skipped, rel)
+			return nil
+		}
+		checkouts = append(checkouts, c)
+		return nil
+	})
+
+	if err != nil {
+		return manifest.Manifest{}, errors.Wrap(err, "walk failed")
+	}
+
+	if len(skipped) != 0 {
+		log.Printf("remote not found, skipped: %s\n", strings.Join(skipped, ", "))
+	}
+
+	if len(checkouts) == 0 {
+		return manifest.Manifest{}, errors.New("repository not found")
+	}
+
+	return generate(checkouts), nil
+}
+
+// checkout reads the remote URL and HEAD of the git repository in dir.
+// nolint: gosec
+func (r Repo) checkout(dir, path string) (checkout, error) {
+	git := func(args ...string) (string, error) {
+		out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).Output()
+		return strings.TrimSpace(string(out)), err
+	}
+
+	remote, err := git("remote")
+	if err != nil || remote == "" {
+		return checkout{}, errors.New("remote not found")
+	}
+
+	remotes := strings.Fields(remote)
+	remote = remotes[0]
+
+	for _, val := range remotes {
+		if val == "origin" {
+			remote = val
+		}
+	}
+
+	u, err := git("remote", "get-url", remote)
+	if err != nil {
+		return checkout{}, errors.Wrap(err, "url failed")
+	}
+
+	fetch, name, err := splitUrl(u)
+	if err != nil {
+		return checkout{}, errors.Wrap(err, "url invalid")
+	}
+
+	commit, err := git("rev-parse", "HEAD")
+	if err != nil {
+		return checkout{}, errors.Wrap(err, "head failed")
+	}
+
+	branch, _ := git("symbolic-ref", "-q", "--short", "HEAD")
+
+	return checkout{
+		path:   path,
+		fetch:  fetch,
+		name:   name,
+		commit: commit,
+		branch: branch,
+	}, nil
+}
+
+// splitUrl splits the remote URL u into the fetch URL of its host and the
+// project name, where scp-like URLs are rewritten to ssh ones. Users and
+// passwords are dropped from the fetch URL so as not to leak credentials.
+func splitUrl(u string) (fetch, name string, err error) {
+	if !strings.Contains(u, "://") {
+		if match := scpPattern.FindStringSubmatch(u); match != nil {
+			u = "ssh://" + match[2] + "/" + strings.TrimPrefix(match[3], "/")
+		}
+	}
+
+	buf, err := url.Parse(u)
+	if err != nil {
+		return "", "", err
+	}
+
+	if buf.Scheme == "" || buf.Host == "" {
+		return "", "", errors.New("url invalid")
+	}
+
+	name = strings.TrimSuffix(strings.Trim(buf.Path, "/"), ".git")
+	if name == "" {
+		return "", "", errors.New("name invalid")
+	}
+
+	buf.User = nil
+	buf.Path, buf.RawPath = "", ""
+
+	return buf.String(), name, nil
+}
+
+func generate(checkouts []checkout) manifest.Manifest {
+	var m manifest.Manifest
+
+	remotes := map[string]string{}
+	counts := map[string]int{}
+	names := map[string]bool{}
+
+	for _, val := range checkouts {
+		if _, ok := remotes[val.fetch]; !ok {
+			name := remoteName(val.fetch)
+			for i := 2; names[name]; i++ {
+				name = remoteName(val.fetch) + "-" + strconv.Itoa(i)
+			}
+			names[name] = true
+			remotes[val.fetch] = name
+			m.Remotes = append(m.Remotes, manifest.Remote{Name: name, Fetch: val.fetch})
+		}
+		counts[remotes[val.fetch]]++
+	}
+
+	remote := m.Remotes[0].Name
+
+	for _, val := range m.Remotes {
+		if counts[val.Name] > counts[remote] {
+			remote = val.Name
+		}
+	}
+
+	m.Default = &manifest.Default{Remote: remote}
+
+	for _, val := range checkouts {
+		p := manifest.Project{
+			Name:     val.name,
+			Path:     val.path,
+			Revision: val.commit,
+			Upstream: val.branch,
+		}
+		if p.Path == p.Name {
+			p.Path = ""
+		}
+		if remotes[val.fetch] != remote {
+			p.Remote = remotes[val.fetch]
+		}
+		m.Projects = append(m.Projects, p)
+	}
+
+	return m
+}
+
+// remoteName returns the remote name for fetch, which is the first label of
+// its host like github for https://github.com.
+func remoteName(fetch string) string {
+	buf, err := url.Parse(fetch)
+	if err != nil || buf.Hostname() == "" {
+		return "local"
+	}
+
+	return strings.Split(buf.Hostname(), ".")[0]
+}
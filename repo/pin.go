@@ -0,0 +1,213 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"gorepo/config"
+	"gorepo/gitiles"
+	"gorepo/manifest"
+)
+
+const (
+	refsHeads = "refs/heads/"
+	refsTags  = "refs/tags/"
+	refs      = "refs/"
+)
+
+// Pin resolves the revision of every project in manifest name to SHA1 via
+// Gitiles, keeps the original revision in upstream, and writes the frozen
+// manifest to output. Name is loaded by LoadManifest.
+func (r Repo) Pin(name, output string, jobs int, c *config.Gitiles) error {
+	return r.pinFile(name, output, jobs, c, func(g *gitiles.Gitiles, project, rev string) (string, error) {
+		return r.revisionCommit(g, project, rev)
+	})
+}
+
+// PinAtTime is like Pin, but pins every project to the last commit on its
+// branch committed at or before _time.
+func (r Repo) PinAtTime(name, output, _time string, jobs int, c *config.Gitiles) error {
+	t, err := time.Parse(Time1, _time)
+	if err != nil {
+		return errors.Wrap(err, "time invalid")
+	}
+
+	return r.pinFile(name, output, jobs, c, func(g *gitiles.Gitiles, project, rev string) (string, error) {
+		return r.commitAtTime(g, project, rev, t, c.MaxPages)
+	})
+}
+
+func (r Repo) pinFile(name, output string, jobs int, c *config.Gitiles,
+	commit func(*gitiles.Gitiles, string, string) (string, error)) error {
+	m, err := r.LoadManifest(name, c)
+	if err != nil {
+		return errors.Wrap(err, "load failed")
+	}
+
+	g := gitiles.Gitiles{}
+
+	if err := g.Init(c.Url, c.User, c.Pass); err != nil {
+		return errors.Wrap(err, "init failed")
+	}
+
+	u := r.manifestOrigin(name, c)
+
+	err = r.pin(&m, jobs, func(p manifest.Project, rev string) (string, error) {
+		return commit(&g, r.gitilesName(&m, p, u, c), rev)
+	})
+
+	if err != nil {
+		return errors.Wrap(err, "pin failed")
+	}
+
+	if err := m.Write(output); err != nil {
+		return errors.Wrap(err, "write failed")
+	}
+
+	return nil
+}
+
+// pin sets the revision of every project in m, nested or not, not pinned to
+// SHA1 yet to what commit returns for it as flattened by manifest.Walk,
+// keeping the original revision in upstream.
+func (r Repo) pin(m *manifest.Manifest, jobs int, commit func(manifest.Project, string) (string, error)) error {
+	var failed []string
+	var mutex sync.Mutex
+	var projects []*manifest.Project
+	var flats []manifest.Project
+
+	m.Walk(func(p *manifest.Project, flat manifest.Project) {
+		projects = append(projects, p)
+		flats = append(flats, flat)
+	})
+
+	r.parallel(len(projects), jobs, func(index int) {
+		p := projects[index]
+		rev, err := m.Revision(*p)
+		if err == nil && manifest.RevisionType(rev) == manifest.TypeSha {
+			return
+		}
+		var sha string
+		if err == nil {
+			sha, err = commit(flats[index], rev)
+		}
+		if err != nil {
+			mutex.Lock()
+			failed = append(failed, flats[index].Name+": "+err.Error())
+			mutex.Unlock()
+			return
+		}
+		p.Revision = sha
+		if p.Upstream == "" {
+			p.Upstream = rev
+		}
+	})
+
+	if len(failed) != 0 {
+		sort.Strings(failed)
+		return errors.New(strings.Join(failed, "; "))
+	}
+
+	return nil
+}
+
+// revisionCommit returns the commit of revision, which is a branch or a tag
+// with or without refs/heads/ and refs/tags/ respectively.
+func (r Repo) revisionCommit(g *gitiles.Gitiles, project, revision string) (string, error) {
+	branch := func(name string) (string, error) {
+		c, err := g.Commit(project, opBranch+name)
+		if err != nil {
+			return "", errors.Wrap(err, "commit failed")
+		}
+		return c.Commit, nil
+	}
+
+	switch {
+	case strings.HasPrefix(revision, refsHeads):
+		return branch(strings.TrimPrefix(revision, refsHeads))
+	case strings.HasPrefix(revision, refsTags):
+		return r.tagCommit(g, project, strings.TrimPrefix(revision, refsTags))
+	case strings.HasPrefix(revision, refs):
+		return "", errors.New("revision unsupported")
+	}
+
+	commit, err := branch(revision)
+	if err == nil {
+		return commit, nil
+	}
+
+	return r.tagCommit(g, project, revision)
+}
+
+// commitAtTime returns the last commit of revision committed at or before t,
+// walking max pages of the log at most.
+func (r Repo) commitAtTime(g *gitiles.Gitiles, project, revision string, t time.Time, max int) (string, error) {
+	var commit string
+
+	operator := opBranch + strings.TrimPrefix(revision, refsHeads)
+	if strings.HasPrefix(revision, refsTags) {
+		operator = opTag + strings.TrimPrefix(revision, refsTags)
+	}
+
+	err := r.walkLog(g, project, operator, max, func(val gitiles.Commit) (bool, error) {
+		if val.Committer.Time.After(t) {
+			return false, nil
+		}
+		commit = val.Commit
+		return true, nil
+	})
+
+	if err != nil {
+		return "", errors.Wrap(err, "walk failed")
+	}
+
+	if commit == "" {
+		return "", errors.New("commit not found")
+	}
+
+	return commit, nil
+}
+
+// parallel calls fn with 0 to total-1 in up to jobs goroutines.
+func (r Repo) parallel(total, jobs int, fn func(int)) {
+	var wg sync.WaitGroup
+
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	ch := make(chan int)
+
+	for i := 0; i < jobs; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range ch {
+				fn(index)
+			}
+		}()
+	}
+
+	for index := 0; index < total; index++ {
+		ch <- index
+	}
+
+	close(ch)
+	wg.Wait()
+}
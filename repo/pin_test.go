@@ -0,0 +1,201 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"gorepo/config"
+	"gorepo/gitiles"
+	"gorepo/manifest"
+)
+
+func TestPin(t *testing.T) {
+	s := newGitiles()
+	defer s.Close()
+
+	c := config.Gitiles{
+		Pass: "",
+		Url:  s.URL,
+		User: "",
+	}
+
+	r := Repo{}
+
+	name := filepath.Join(t.TempDir(), "pinned.xml")
+
+	err := r.Pin("../test/manifest-1.xml", name, 2, &c)
+	assert.Equal(t, nil, err)
+
+	m := manifest.Manifest{}
+
+	err = m.Load(name)
+	assert.Equal(t, nil, err)
+
+	p, _ := m.Project("platform/build")
+	assert.Equal(t, strings.Repeat("a", 40), p.Revision)
+	assert.Equal(t, "master", p.Upstream)
+
+	p, _ = m.Project("platform/build/soong")
+	assert.Equal(t, "14a08f5b2881fb67d772dfec2e3d0eaa189ba9d1", p.Revision)
+	assert.Equal(t, "", p.Upstream)
+
+	p, _ = m.Project("platform/art")
+	assert.Equal(t, "c3", p.Revision)
+	assert.Equal(t, "android10-release", p.Upstream)
+
+	buf, err := os.ReadFile("../test/manifest-1.xml")
+	assert.Equal(t, nil, err)
+
+	name = filepath.Join(t.TempDir(), "manifest.xml")
+	err = os.WriteFile(name, []byte(strings.Replace(string(buf), `revision="android10-release"`,
+		`revision="refs/heads/android11-release"`, 1)), 0600)
+	assert.Equal(t, nil, err)
+
+	err = r.Pin(name, filepath.Join(t.TempDir(), "pinned.xml"), 1, &c)
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, true, strings.Contains(err.Error(), "platform/art"))
+
+	err = os.WriteFile(name, []byte(`<manifest>
+  <default revision="master"/>
+  <project name="platform/build" path="build/make">
+    <project name="blueprint" path="blueprint"/>
+  </project>
+</manifest>`), 0600)
+	assert.Equal(t, nil, err)
+
+	output := filepath.Join(t.TempDir(), "pinned.xml")
+
+	err = r.Pin(name, output, 1, &c)
+	assert.Equal(t, nil, err)
+
+	err = m.Load(output)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, strings.Repeat("a", 40), m.Projects[0].Revision)
+	assert.Equal(t, strings.Repeat("b", 40), m.Projects[0].Projects[0].Revision)
+	assert.Equal(t, "master", m.Projects[0].Projects[0].Upstream)
+}
+
+func TestPinAtTime(t *testing.T) {
+	s := newGitiles()
+	defer s.Close()
+
+	c := config.Gitiles{
+		Pass: "",
+		Url:  s.URL,
+		User: "",
+	}
+
+	r := Repo{}
+
+	name := filepath.Join(t.TempDir(), "pinned.xml")
+
+	err := r.PinAtTime("../test/manifest-1.xml", name, "2020-05-01T00:00:00", 2, &c)
+	assert.NotEqual(t, nil, err)
+	assert.Equal(t, true, strings.Contains(err.Error(), "platform/build:"))
+
+	err = r.PinAtTime("../test/manifest-1.xml", name, "2020-06-25T12:00:00", 2, &c)
+	assert.Equal(t, nil, err)
+
+	m := manifest.Manifest{}
+
+	err = m.Load(name)
+	assert.Equal(t, nil, err)
+
+	p, _ := m.Project("platform/build")
+	assert.Equal(t, strings.Repeat("a", 40), p.Revision)
+
+	p, _ = m.Project("platform/art")
+	assert.Equal(t, "c1", p.Revision)
+	assert.Equal(t, "android10-release", p.Upstream)
+
+	err = r.PinAtTime("../test/manifest-1.xml", name, "2020-06-26", 2, &c)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestCommitAtTime(t *testing.T) {
+	s := newGitiles()
+	defer s.Close()
+
+	g := gitiles.Gitiles{}
+	_ = g.Init(s.URL, "", "")
+
+	r := Repo{}
+
+	at := func(s string) time.Time {
+		b, _ := time.Parse(Time1, s)
+		return b
+	}
+
+	commit, err := r.commitAtTime(&g, "platform/art", "android10-release", at("2020-06-24T00:00:00"), 0)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "c2", commit)
+
+	commit, err = r.commitAtTime(&g, "platform/art", "refs/heads/android10-release", at("2030-01-01T00:00:00"), 0)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "c0", commit)
+
+	_, err = r.commitAtTime(&g, "platform/art", "android10-release", at("2020-01-01T00:00:00"), 0)
+	assert.NotEqual(t, nil, err)
+
+	_, err = r.commitAtTime(&g, "platform/art", "refs/tags/android10-release", at("2020-01-01T00:00:00"), 0)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestRevisionCommit(t *testing.T) {
+	s := newGitiles()
+	defer s.Close()
+
+	g := gitiles.Gitiles{}
+	_ = g.Init(s.URL, "", "")
+
+	r := Repo{}
+
+	commit, err := r.revisionCommit(&g, "platform/build", "refs/heads/master")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, strings.Repeat("a", 40), commit)
+
+	commit, err = r.revisionCommit(&g, "platform/art", "refs/tags/android10-light")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "c1", commit)
+
+	commit, err = r.revisionCommit(&g, "platform/art", "android10-release")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "c3", commit)
+
+	_, err = r.revisionCommit(&g, "platform/art", "refs/changes/01/1/1")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestParallel(t *testing.T) {
+	var count int32
+
+	r := Repo{}
+
+	r.parallel(100, 8, func(index int) {
+		atomic.AddInt32(&count, int32(index))
+	})
+
+	assert.Equal(t, int32(4950), count)
+
+	r.parallel(0, 0, func(int) {
+		t.Fail()
+	})
+}
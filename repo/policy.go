@@ -0,0 +1,141 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+
+	"gorepo/manifest"
+)
+
+// Policies is a policy file of rules enforced on manifests.
+type Policies struct {
+	Policies []Policy `json:"policies" yaml:"policies"`
+}
+
+// Policy is a rule named Name enforced on the projects Match selects, which
+// are reported with Severity, defaulting to error, if violated.
+type Policy struct {
+	Name              string      `json:"name" yaml:"name"`
+	Severity          string      `json:"severity,omitempty" yaml:"severity,omitempty"`
+	Match             PolicyMatch `json:"match,omitempty" yaml:"match,omitempty"`
+	RequireSHA1       bool        `json:"require-sha1,omitempty" yaml:"require-sha1,omitempty"`
+	ForbidRevisions   []string    `json:"forbid-revisions,omitempty" yaml:"forbid-revisions,omitempty"`
+	RequireCloneDepth bool        `json:"require-clone-depth,omitempty" yaml:"require-clone-depth,omitempty"`
+}
+
+// PolicyMatch selects projects like manifest.Query does.
+type PolicyMatch struct {
+	Groups string `json:"groups,omitempty" yaml:"groups,omitempty"`
+	Name   string `json:"name,omitempty" yaml:"name,omitempty"`
+	Path   string `json:"path,omitempty" yaml:"path,omitempty"`
+	Remote string `json:"remote,omitempty" yaml:"remote,omitempty"`
+}
+
+// LoadPolicies reads the policy file in name in the format of its extension,
+// which is JSON or YAML.
+func (r Repo) LoadPolicies(name string) (Policies, error) {
+	var p Policies
+
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		return p, errors.Wrap(err, "read failed")
+	}
+
+	switch manifest.Format(name) {
+	case manifest.FormatJson:
+		d := json.NewDecoder(bytes.NewReader(buf))
+		d.DisallowUnknownFields()
+		err = d.Decode(&p)
+	case manifest.FormatYaml:
+		err = yaml.UnmarshalStrict(buf, &p)
+	default:
+		return p, errors.New("format invalid")
+	}
+
+	if err != nil {
+		return p, errors.Wrap(err, "decode failed")
+	}
+
+	for _, val := range p.Policies {
+		if val.Name == "" {
+			return p, errors.New("policy name required")
+		}
+		if val.Severity != "" && val.Severity != manifest.Error && val.Severity != manifest.Warning {
+			return p, errors.New("policy " + val.Name + " severity invalid")
+		}
+	}
+
+	return p, nil
+}
+
+// Lint loads the manifest in name and reports the projects violating policies.
+func (r Repo) Lint(name string, policies Policies) ([]manifest.Violation, error) {
+	var violations []manifest.Violation
+
+	m := manifest.Manifest{}
+
+	if err := m.Load(name); err != nil {
+		return nil, errors.Wrap(err, "load failed")
+	}
+
+	index := manifest.NewIndex(&m)
+
+	for _, policy := range policies.Policies {
+		entries, err := m.List(manifest.Query{
+			Groups: policy.Match.Groups,
+			Name:   policy.Match.Name,
+			Path:   policy.Match.Path,
+			Remote: policy.Match.Remote,
+		})
+		if err != nil {
+			return nil, errors.Wrap(err, "policy "+policy.Name+" invalid")
+		}
+		severity := policy.Severity
+		if severity == "" {
+			severity = manifest.Error
+		}
+		report := func(e manifest.Entry, format string, args ...interface{}) {
+			p, _ := index.Path(e.Path)
+			violations = append(violations, manifest.Violation{
+				Source:   p.Source(),
+				Severity: severity,
+				Rule:     policy.Name,
+				Message:  fmt.Sprintf("project %s ", e.Name) + fmt.Sprintf(format, args...),
+			})
+		}
+		for _, e := range entries {
+			if policy.RequireSHA1 && manifest.RevisionType(e.Revision) != manifest.TypeSha {
+				report(e, "revision %s not pinned to SHA1", manifest.OrNone(e.Revision))
+			}
+			for _, val := range policy.ForbidRevisions {
+				if e.Revision == val || strings.TrimPrefix(e.Revision, refsHeads) == strings.TrimPrefix(val, refsHeads) {
+					report(e, "revision %s forbidden", e.Revision)
+					break
+				}
+			}
+			if policy.RequireCloneDepth && e.CloneDepth == "" {
+				report(e, "clone-depth missing")
+			}
+		}
+	}
+
+	return violations, nil
+}
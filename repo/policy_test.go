@@ -0,0 +1,96 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gorepo/manifest"
+)
+
+func writePolicies(t *testing.T, name, buf string) string {
+	name = filepath.Join(t.TempDir(), name)
+
+	err := os.WriteFile(name, []byte(buf), 0600)
+	assert.Equal(t, nil, err)
+
+	return name
+}
+
+func TestLint(t *testing.T) {
+	r := Repo{}
+
+	policies, err := r.LoadPolicies(writePolicies(t, "policy.yaml", `policies:
+- name: release-pinned
+  require-sha1: true
+- name: no-master
+  severity: warning
+  forbid-revisions: [refs/heads/master]
+  match:
+    path: ^build/
+- name: tradefed-shallow
+  require-clone-depth: true
+  match:
+    groups: tradefed
+`))
+	assert.Equal(t, nil, err)
+
+	violations, err := r.Lint("../test/manifest-1.xml", policies)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 6, len(violations))
+	assert.Equal(t, manifest.Violation{
+		Source:   manifest.Source{File: "../test/manifest-1.xml", Line: 4},
+		Severity: manifest.Error,
+		Rule:     "release-pinned",
+		Message:  "project platform/build revision master not pinned to SHA1",
+	}, violations[0])
+	assert.Equal(t, "release-pinned", violations[2].Rule)
+	assert.Equal(t, "project platform/art revision android10-release not pinned to SHA1", violations[2].Message)
+	assert.Equal(t, manifest.Warning, violations[3].Severity)
+	assert.Equal(t, "project platform/build revision master forbidden", violations[3].Message)
+	assert.Equal(t, "project platform/build/blueprint revision master forbidden", violations[4].Message)
+	assert.Equal(t, "project platform/build/soong clone-depth missing", violations[5].Message)
+
+	_, err = r.Lint("../test/none.xml", policies)
+	assert.NotEqual(t, nil, err)
+
+	_, err = r.Lint("../test/manifest-1.xml", Policies{Policies: []Policy{{Name: "a", Match: PolicyMatch{Name: "("}}}})
+	assert.NotEqual(t, nil, err)
+}
+
+func TestLoadPolicies(t *testing.T) {
+	r := Repo{}
+
+	p, err := r.LoadPolicies(writePolicies(t, "policy.json", `{"policies":[{"name":"a","require-sha1":true}]}`))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, true, p.Policies[0].RequireSHA1)
+
+	_, err = r.LoadPolicies(writePolicies(t, "policy.json", `{"policies":[{"require-sha1":true}]}`))
+	assert.NotEqual(t, nil, err)
+
+	_, err = r.LoadPolicies(writePolicies(t, "policy.json", `{"policies":[{"name":"a","severity":"fatal"}]}`))
+	assert.NotEqual(t, nil, err)
+
+	_, err = r.LoadPolicies(writePolicies(t, "policy.yaml", "policies:\n- name: a\n  require-sha: true\n"))
+	assert.NotEqual(t, nil, err)
+
+	_, err = r.LoadPolicies(writePolicies(t, "policy.xml", "<policies/>"))
+	assert.NotEqual(t, nil, err)
+
+	_, err = r.LoadPolicies(filepath.Join(t.TempDir(), "none.yaml"))
+	assert.NotEqual(t, nil, err)
+}
@@ -18,7 +18,8 @@ import (
 	"log"
 	"os"
 	"os/exec"
-	"regexp"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -36,10 +37,10 @@ const (
 	Prefix = "repo launcher version"
 	Total  = 2
 
-	SHA1 = "^[0-9a-f]{40}$"
+	SHA1 = manifest.SHA1
 
 	Time1 = "2006-01-02T15:04:05"
-	Time2 = "Mon Jan 2 15:04:05 2006 -0700"
+	Time2 = gitiles.TimeFormat
 )
 
 const (
@@ -48,6 +49,19 @@ const (
 	manifestUrl    = "--manifest-url="
 	repoUrl        = "--repo-url="
 	repoDepth      = "--depth="
+	repoGroups     = "--groups="
+)
+
+const (
+	specConcat  = "/+/"
+	specGitiles = "gitiles:"
+)
+
+const (
+	opBranch = "branch:"
+	opCommit = "commit:"
+	opTag    = "tag:"
+	peelMax  = 5
 )
 
 type Repo struct {
@@ -61,19 +75,49 @@ func (r Repo) Init(i *config.Init, g *config.Gitiles) error {
 		return errors.New("config invalid")
 	}
 
-	cmd := exec.Command("repo", "init",
-		manifestBranch+i.ManifestBranch,
-		manifestName+i.ManifestName,
-		manifestUrl+i.ManifestUrl,
-		repoUrl+i.RepoUrl,
-		repoDepth+strconv.Itoa(i.Depth))
+	var missing map[string]string
+	var unlisted []string
+
+	if i.TagSince != "" {
+		// Check tag before repo init changes the workspace.
+		project, err := r.gitilesProject(i.ManifestUrl, g.Url)
+		if err != nil {
+			return errors.Wrap(err, "manifest url invalid")
+		}
+		spec := specGitiles + project + specConcat + i.ManifestBranch + "/" + i.ManifestName
+		if missing, unlisted, err = r.CheckTag(spec, i.TagSince, i.Groups, g); err != nil {
+			return errors.Wrap(err, "check failed")
+		}
+	}
+
+	args := []string{"init",
+		manifestBranch + i.ManifestBranch,
+		manifestName + i.ManifestName,
+		manifestUrl + i.ManifestUrl,
+		repoUrl + i.RepoUrl,
+		repoDepth + strconv.Itoa(i.Depth)}
+
+	if i.Groups != "" {
+		args = append(args, repoGroups+i.Groups)
+	}
+
+	cmd := exec.Command("repo", args...)
 
 	if err := r.Run(cmd); err != nil {
 		return errors.Wrap(err, "init failed")
 	}
 
+	if i.VerifyKeyring != "" {
+		name := filepath.Join(".repo", "manifests", i.ManifestName)
+		if err := r.VerifyManifest(name, filepath.Join(".repo", "local_manifests"), i.VerifyFormat, i.VerifyKeyring); err != nil {
+			return errors.Wrap(err, "verify failed")
+		}
+	}
+
+	// Local manifests are left to be overlaid again by repo sync and gorepo.
 	cmd = exec.Command("repo", "manifest",
 		manifestName+i.ManifestName,
+		"--no-local-manifests",
 		"--output-file=manifest.xml")
 
 	if err := r.Run(cmd); err != nil {
@@ -87,13 +131,14 @@ func (r Repo) Init(i *config.Init, g *config.Gitiles) error {
 	}
 
 	if i.TagSince != "" {
-		if err := r.ShallowAfterTag(".repo/manifest.xml", i.TagSince, g); err != nil {
+		err := r.shallowAfterTag(".repo/manifest.xml", i.TagSince, i.Groups, i.TagNearest, missing, unlisted, g)
+		if err != nil {
 			return errors.Wrap(err, "shallow failed")
 		}
 	}
 
 	if i.TimeSince != "" {
-		if err := r.ShallowAfterTime(".repo/manifest.xml", i.TimeSince, g); err != nil {
+		if err := r.ShallowAfterTime(".repo/manifest.xml", i.TimeSince, i.Groups, g); err != nil {
 			return errors.Wrap(err, "shallow failed")
 		}
 	}
@@ -101,6 +146,153 @@ func (r Repo) Init(i *config.Init, g *config.Gitiles) error {
 	return nil
 }
 
+// IsGitiles reports whether name is a gitiles:PROJECT/+/REVISION/PATH spec
+// rather than a local file, which has no local manifests to overlay.
+func (r Repo) IsGitiles(name string) bool {
+	return strings.HasPrefix(name, specGitiles)
+}
+
+// LoadManifest loads the manifest in name, which is a local file, or
+// gitiles:PROJECT/+/REVISION/PATH for the one in the manifest repository
+// PROJECT at REVISION on Gitiles, where REVISION is a branch, tag, commit,
+// refs/heads/BRANCH or refs/tags/TAG. REVISION may contain slashes, and is
+// resolved to the longest ref of PROJECT matching like Gitiles does.
+func (r Repo) LoadManifest(name string, c *config.Gitiles) (manifest.Manifest, error) {
+	m := manifest.Manifest{}
+
+	if !r.IsGitiles(name) {
+		if err := m.Load(name); err != nil {
+			return m, errors.Wrap(err, "load failed")
+		}
+		return m, nil
+	}
+
+	project, path, err := r.parseSpec(name)
+	if err != nil {
+		return m, errors.Wrap(err, "spec invalid")
+	}
+
+	g := gitiles.Gitiles{}
+
+	if err := g.Init(c.Url, c.User, c.Pass); err != nil {
+		return m, errors.Wrap(err, "init failed")
+	}
+
+	revision, file, err := r.splitRevision(&g, project, path)
+	if err != nil {
+		return m, errors.Wrap(err, "spec invalid")
+	}
+
+	if err := m.LoadGitiles(&g, project, revision, file); err != nil {
+		return m, errors.Wrap(err, "load failed")
+	}
+
+	return m, nil
+}
+
+// parseSpec splits the gitiles spec name into the project and the path after
+// /+/, which is the revision followed by the file.
+func (r Repo) parseSpec(name string) (project, path string, err error) {
+	buf := strings.SplitN(strings.TrimPrefix(name, specGitiles), specConcat, 2)
+	if len(buf) != 2 || buf[0] == "" {
+		return "", "", errors.New("project invalid")
+	}
+
+	if !strings.Contains(strings.Trim(buf[1], "/"), "/") {
+		return "", "", errors.New("path invalid")
+	}
+
+	return buf[0], strings.Trim(buf[1], "/"), nil
+}
+
+// splitRevision splits path into the revision and the file, where the
+// revision is a commit, or the longest prefix of path naming a ref of project
+// in full, or a branch or a tag.
+func (r Repo) splitRevision(g *gitiles.Gitiles, project, path string) (revision, file string, err error) {
+	segments := strings.Split(path, "/")
+
+	if manifest.RevisionType(segments[0]) == manifest.TypeSha {
+		return segments[0], strings.Join(segments[1:], "/"), nil
+	}
+
+	names, err := g.Refs(project, "")
+	if err != nil {
+		return "", "", errors.Wrap(err, "refs failed")
+	}
+
+	for i := len(segments) - 1; i > 0; i-- {
+		rev := strings.Join(segments[:i], "/")
+		for _, val := range []string{rev, refsHeads + rev, refsTags + rev} {
+			if _, ok := names[val]; ok {
+				return rev, strings.Join(segments[i:], "/"), nil
+			}
+		}
+	}
+
+	return "", "", errors.New("revision not found")
+}
+
+// gitilesProject returns the project of the repository in u on Gitiles in
+// base, ignoring schemes, the .git suffix and the a/ prefix of authenticated
+// access.
+func (r Repo) gitilesProject(u, base string) (string, error) {
+	trim := func(name string) string {
+		if index := strings.Index(name, "://"); index >= 0 {
+			name = name[index+3:]
+		}
+		return strings.TrimRight(name, "/")
+	}
+
+	project := strings.TrimSuffix(trim(u), ".git")
+	if !strings.HasPrefix(project, trim(base)+"/") {
+		return "", errors.New("project not on gitiles")
+	}
+
+	project = strings.Trim(strings.TrimPrefix(project, trim(base)), "/")
+
+	return strings.TrimPrefix(project, "a/"), nil
+}
+
+// manifestOrigin returns the URL of the manifest repository of manifest name,
+// which is the project on Gitiles for gitiles specs, and the origin of the
+// manifests.git repo init leaves next to name otherwise, or empty if unknown.
+// nolint: gosec
+func (r Repo) manifestOrigin(name string, c *config.Gitiles) string {
+	if r.IsGitiles(name) {
+		project, _, err := r.parseSpec(name)
+		if err != nil {
+			return ""
+		}
+		return strings.TrimRight(c.Url, "/") + "/" + project
+	}
+
+	file := filepath.Join(filepath.Dir(name), "manifests.git", "config")
+
+	out, err := exec.Command("git", "config", "--file", file, "remote.origin.url").Output()
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(out))
+}
+
+// gitilesName returns the project of p on Gitiles, which is the one in its
+// fetch URL resolved by Endpoint against the manifest repository in u, or its
+// name if p is fetched from elsewhere.
+func (r Repo) gitilesName(m *manifest.Manifest, p manifest.Project, u string, c *config.Gitiles) string {
+	e, err := m.Endpoint(p, u)
+	if err != nil {
+		return p.Name
+	}
+
+	project, err := r.gitilesProject(e.Fetch, c.Url)
+	if err != nil {
+		return p.Name
+	}
+
+	return project
+}
+
 // nolint: gosec
 func (r Repo) Sync(s *config.Sync) error {
 	var verbose string
@@ -200,16 +392,151 @@ func (r Repo) Run(c *exec.Cmd) error {
 	return nil
 }
 
-func (r Repo) DepthAfterTag(project, tag string, c *config.Gitiles) (int, error) {
-	// TODO: FIXME
-	return 0, nil
+func (r Repo) DepthAfterTag(project, branch, tag string, c *config.Gitiles) (int, error) {
+	g := gitiles.Gitiles{}
+
+	if err := g.Init(c.Url, c.User, c.Pass); err != nil {
+		return 0, errors.Wrap(err, "init failed")
+	}
+
+	commit, err := r.tagCommit(&g, project, tag)
+	if err != nil {
+		return 0, errors.Wrap(err, "tag failed")
+	}
+
+	depth := 0
+	found := false
+
+	err = r.walkLog(&g, project, opBranch+branch, c.MaxPages, func(val gitiles.Commit) (bool, error) {
+		depth++
+		found = val.Commit == commit
+		return found, nil
+	})
+
+	if err != nil {
+		return 0, errors.Wrap(err, "walk failed")
+	}
+
+	if !found {
+		return 0, errors.New("tag not reachable")
+	}
+
+	return depth, nil
+}
+
+// ShallowAfterTag sets clone-depth of projects in manifest name selected by
+// groups to the depth after tag. It checks tag in every project first, and
+// the projects without it fall back to the nearest tag if nearest is true, or
+// to full clone otherwise, like the ones whose tags cannot be listed.
+func (r Repo) ShallowAfterTag(name, tag, groups string, nearest bool, c *config.Gitiles) error {
+	missing, unlisted, err := r.CheckTag(name, tag, groups, c)
+	if err != nil {
+		return errors.Wrap(err, "check failed")
+	}
+
+	return r.shallowAfterTag(name, tag, groups, nearest, missing, unlisted, c)
 }
 
-func (r Repo) ShallowAfterTag(name, tag string, c *config.Gitiles) error {
-	// TODO: FIXME
+// shallowAfterTag is like ShallowAfterTag with tag checked already, where
+// missing and unlisted are returned by CheckTag.
+func (r Repo) shallowAfterTag(name, tag, groups string, nearest bool, missing map[string]string,
+	unlisted []string, c *config.Gitiles) error {
+	if len(unlisted) != 0 {
+		log.Printf("tags not listed, fallback to full clone: %s\n", strings.Join(unlisted, ", "))
+	}
+
+	if len(missing) != 0 {
+		var buf []string
+		for key, val := range missing {
+			buf = append(buf, key+" (nearest: "+manifest.OrNone(val)+")")
+		}
+		sort.Strings(buf)
+		log.Printf("tag %s not found: %s\n", tag, strings.Join(buf, ", "))
+	}
+
+	skipped := map[string]bool{}
+	for _, val := range unlisted {
+		skipped[val] = true
+	}
+
+	fallback, err := r.shallow(name, groups, c, func(project, rev string) (int, error) {
+		if skipped[project] {
+			return 0, errors.New("tags not listed")
+		}
+		t := tag
+		if val, ok := missing[project]; ok {
+			if !nearest || val == "" {
+				return 0, errors.New("tag not found")
+			}
+			t = val
+		}
+		return r.DepthAfterTag(project, rev, t, c)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	var buf []string
+
+	for _, val := range fallback {
+		if !skipped[val] {
+			buf = append(buf, val)
+		}
+	}
+
+	if len(buf) != 0 {
+		log.Printf("tag %s not found, fallback to full clone: %s\n", tag, strings.Join(buf, ", "))
+	}
+
 	return nil
 }
 
+// tagCommit returns the commit of tag, peeling annotated tags if needed.
+func (r Repo) tagCommit(g *gitiles.Gitiles, project, tag string) (string, error) {
+	t, err := g.Tag(project, opTag+tag)
+	if err != nil {
+		return "", errors.Wrap(err, "tag failed")
+	}
+
+	for i := 0; i < peelMax; i++ {
+		if t.Commit != "" {
+			return t.Commit, nil
+		}
+		if t.Type == "" || t.Type == "commit" {
+			return t.Object, nil
+		}
+		if t.Type != "tag" {
+			return "", errors.New("tag invalid")
+		}
+		if t, err = g.Tag(project, opCommit+t.Object); err != nil {
+			return "", errors.Wrap(err, "tag failed")
+		}
+	}
+
+	return "", errors.New("tag invalid")
+}
+
+// walkLog calls fn with the commits of operator page by page until fn
+// returns true or the log ends, walking max pages at most unless max is 0.
+func (r Repo) walkLog(g *gitiles.Gitiles, project, operator string, max int, fn func(gitiles.Commit) (bool, error)) error {
+	i := g.Logs(project, operator, 0, max)
+
+	for i.Next() {
+		done, err := fn(i.Commit())
+		if err != nil {
+			return err
+		}
+		if done {
+			return nil
+		}
+	}
+
+	return i.Err()
+}
+
+// DepthAfterTime returns the number of commits on branch committed at or after
+// _time, walking the log until the first commit before it.
 func (r Repo) DepthAfterTime(project, branch, _time string, c *config.Gitiles) (int, error) {
 	g := gitiles.Gitiles{}
 
@@ -217,64 +544,140 @@ func (r Repo) DepthAfterTime(project, branch, _time string, c *config.Gitiles) (
 		return 0, errors.Wrap(err, "init failed")
 	}
 
-	buf, err := g.Query(project, "branch:"+branch)
+	t, err := time.Parse(Time1, _time)
 	if err != nil {
-		return 0, errors.Wrap(err, "query failed")
+		return 0, errors.Wrap(err, "time invalid")
 	}
 
 	depth := 0
-	t, _ := time.Parse(Time1, _time)
 
-	// TODO: FIXME
-	for _, val := range buf["log"].([]interface{}) {
-		c := val.(map[string]interface{})["committer"].(map[string]interface{})
-		b, _ := time.Parse(Time2, c["time"].(string))
-		if b.UTC().Before(t.UTC()) {
-			break
+	err = r.walkLog(&g, project, opBranch+branch, c.MaxPages, func(val gitiles.Commit) (bool, error) {
+		if val.Committer.Time.Before(t) {
+			return true, nil
 		}
 		depth++
+		return false, nil
+	})
+
+	if err != nil {
+		return 0, errors.Wrap(err, "walk failed")
 	}
 
 	return depth, nil
 }
 
-func (r Repo) ShallowAfterTime(name, _time string, c *config.Gitiles) error {
+func (r Repo) ShallowAfterTime(name, _time, groups string, c *config.Gitiles) error {
+	fallback, err := r.shallow(name, groups, c, func(project, rev string) (int, error) {
+		return r.DepthAfterTime(project, rev, _time, c)
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if len(fallback) != 0 {
+		log.Printf("depth after %s failed, fallback to full clone: %s\n", _time, strings.Join(fallback, ", "))
+	}
+
+	return nil
+}
+
+// shallow sets clone-depth of projects in manifest name selected by groups to
+// what depth returns for their names on Gitiles and revisions, skipping the
+// ones pinned to SHA1 or with clone-depth already. Depth is computed on the projects overlaid with local manifests,
+// including the nested ones flattened by Walk, but only set in place in name,
+// and the names of projects which depth failed for are returned.
+func (r Repo) shallow(name, groups string, c *config.Gitiles,
+	depth func(string, string) (int, error)) ([]string, error) {
+	var failed []string
+
 	m := manifest.Manifest{}
 
 	if err := m.Load(name); err != nil {
-		return errors.Wrap(err, "load failed")
+		return nil, errors.Wrap(err, "load failed")
 	}
 
-	projects, err := m.Projects()
-	if err != nil {
-		return errors.Wrap(err, "projects failed")
+	if err := m.Overlay(manifest.LocalDir(name)); err != nil {
+		return nil, errors.Wrap(err, "overlay failed")
 	}
 
-	for index, val := range projects {
-		d, n, _, rev, err := m.Project(val.(map[string]interface{}))
+	var declared, flats, projects []manifest.Project
+	var depths []int
+
+	u := r.manifestOrigin(name, c)
+
+	m.Walk(func(p *manifest.Project, flat manifest.Project) {
+		if flat.MatchGroups(manifest.Groups(groups)) {
+			declared = append(declared, *p)
+			flats = append(flats, flat)
+		}
+	})
+
+	for index, val := range flats {
+		rev, err := m.Revision(val)
 		if err != nil {
-			return errors.Wrap(err, "project failed")
+			return nil, errors.Wrap(err, "revision failed")
 		}
-		re := regexp.MustCompile(SHA1)
-		if matched := re.MatchString(rev); matched {
+		if manifest.RevisionType(rev) == manifest.TypeSha {
 			continue
 		}
-		if _, err := strconv.Atoi(d); err != nil {
-			if depth, err := r.DepthAfterTime(n, rev, _time, c); err == nil {
-				if depth > 0 {
-					projects[index].(map[string]interface{})["-clone-depth"] = strconv.Itoa(depth)
-				}
-			}
+		if _, err := strconv.Atoi(val.CloneDepth); err == nil {
+			continue
+		}
+		d, err := depth(r.gitilesName(&m, val, u, c), rev)
+		if err != nil {
+			failed = append(failed, val.Name)
+			continue
+		}
+		if d > 0 {
+			projects = append(projects, declared[index])
+			depths = append(depths, d)
 		}
 	}
 
-	if err := m.Update(projects); err != nil {
-		return errors.Wrap(err, "update failed")
+	unwritten, err := r.setDepth(name, projects, depths)
+	if err != nil {
+		return nil, errors.Wrap(err, "edit failed")
 	}
 
-	if err := m.Write(name); err != nil {
-		return errors.Wrap(err, "write failed")
+	if len(unwritten) != 0 {
+		log.Printf("depth not written outside %s, fallback to full clone: %s\n", name, strings.Join(unwritten, ", "))
 	}
 
-	return nil
+	return failed, nil
+}
+
+// setDepth patches clone-depth of projects to depths in place in manifest
+// name at the lines they are declared, which keeps comments, ordering and
+// formatting of the manifest. The projects declared in other files, like
+// local manifests and includes owned by users, are left untouched and
+// returned along with the ones not found.
+func (r Repo) setDepth(name string, projects []manifest.Project, depths []int) ([]string, error) {
+	var unwritten []string
+
+	if len(projects) == 0 {
+		return nil, nil
+	}
+
+	e, err := manifest.Edit(name)
+	if err != nil {
+		return nil, errors.Wrap(err, "edit failed")
+	}
+
+	for index, val := range projects {
+		s := val.Source()
+		if filepath.Clean(s.File) != filepath.Clean(name) {
+			unwritten = append(unwritten, val.Name+" ("+s.String()+")")
+			continue
+		}
+		if n, err := e.SetProjectAttrAt(val.Name, s.Line, "clone-depth", strconv.Itoa(depths[index])); err != nil || n != 1 {
+			unwritten = append(unwritten, val.Name+" ("+s.String()+")")
+		}
+	}
+
+	if err := e.Write(name); err != nil {
+		return nil, errors.Wrap(err, "write failed")
+	}
+
+	return unwritten, nil
 }
@@ -13,12 +13,19 @@
 package repo
 
 import (
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 
 	"gorepo/config"
+	"gorepo/gitiles"
+	"gorepo/manifest"
 )
 
 func TestInit(t *testing.T) {
@@ -59,25 +66,466 @@ func TestCheck(t *testing.T) {
 	assert.Equal(t, nil, err)
 }
 
+func newGitiles() *httptest.Server {
+	pages := map[string]string{
+		"/platform/art/+/refs/tags/android10-release": `{"tag":"android10-release","object":"c3","type":"commit"}`,
+		"/platform/art/+/refs/tags/android10-light":   `{"commit":"c1"}`,
+		"/platform/art/+refs/tags": `{"android10-release":{"value":"t3","peeled":"c3"},` +
+			`"android10-light":{"value":"c1"},"android9-release":{"value":"t9","peeled":"c9"}}`,
+		"/platform/art/+log/refs/heads/android10-release": `{"log":[` +
+			`{"commit":"c0","committer":{"time":"Fri Jun 26 00:00:00 2020 +0000"}},` +
+			`{"commit":"c1","committer":{"time":"Thu Jun 25 00:00:00 2020 +0000"}}],"next":"c2"}`,
+		"/platform/art/+log/refs/heads/android10-release/": `{"log":[` +
+			`{"commit":"c2","committer":{"time":"Wed Jun 24 08:00:00 2020 +0800"}},` +
+			`{"commit":"c3","committer":{"time":"Tue Jun 23 00:00:00 2020 +0000"}}]}`,
+		"/platform/build/+refs/tags":           `{}`,
+		"/platform/build/blueprint/+refs/tags": `{}`,
+		"/platform/build/+log/refs/heads/master": `{"log":[` +
+			`{"commit":"` + strings.Repeat("a", 40) + `","committer":{"time":"Thu Jun 25 00:00:00 2020 +0000"}}]}`,
+		"/platform/build/blueprint/+log/refs/heads/master": `{"log":[` +
+			`{"commit":"` + strings.Repeat("b", 40) + `","committer":{"time":"Mon Jun 1 00:00:00 2020 +0000"}}]}`,
+		"/platform/build/+/refs/heads/master":           `{"commit":"` + strings.Repeat("a", 40) + `"}`,
+		"/platform/build/blueprint/+/refs/heads/master": `{"commit":"` + strings.Repeat("b", 40) + `"}`,
+		"/platform/manifest/+refs": `{"HEAD":{"value":"m1","target":"refs/heads/master"},` +
+			`"refs/heads/master":{"value":"m1"},"refs/heads/release/y":{"value":"m2"},` +
+			`"refs/heads/release/x":{"value":"m3"},"refs/tags/v1":{"value":"m4"}}`,
+		"/platform/manifest/+/refs/heads/release/x/default.xml": base64.StdEncoding.EncodeToString([]byte(`<manifest>
+  <project name="platform/art"/>
+</manifest>`)),
+		"/platform/manifest/+/refs/tags/v1/default.xml": base64.StdEncoding.EncodeToString([]byte(`<manifest>
+  <remote fetch=".." name="aosp"/>
+  <default remote="aosp" revision="master"/>
+  <project name="platform/build" path="build/make"/>
+</manifest>`)),
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		buf, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Get("format") == "TEXT" {
+			_, _ = w.Write([]byte(buf))
+			return
+		}
+		_, _ = w.Write([]byte(")]}'\n" + buf))
+	}))
+}
+
+func TestLoadManifest(t *testing.T) {
+	s := newGitiles()
+	defer s.Close()
+
+	c := config.Gitiles{
+		Pass: "",
+		Url:  s.URL,
+		User: "",
+	}
+
+	r := Repo{}
+
+	m, err := r.LoadManifest("gitiles:platform/manifest/+/refs/tags/v1/default.xml", &c)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "platform/build", m.Projects[0].Name)
+
+	m, err = r.LoadManifest("../test/manifest-1.xml", &c)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 4, len(m.Projects))
+
+	m, err = r.LoadManifest("gitiles:platform/manifest/+/refs/heads/release/x/default.xml", &c)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "platform/art", m.Projects[0].Name)
+
+	_, err = r.LoadManifest("gitiles:platform/manifest/+/master/default.xml", &c)
+	assert.NotEqual(t, nil, err)
+
+	_, err = r.LoadManifest("gitiles:platform/manifest/+/master", &c)
+	assert.NotEqual(t, nil, err)
+
+	_, err = r.LoadManifest("../test/none.xml", &c)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestIsGitiles(t *testing.T) {
+	r := Repo{}
+
+	assert.Equal(t, true, r.IsGitiles("gitiles:platform/manifest/+/master/default.xml"))
+	assert.Equal(t, false, r.IsGitiles(".repo/manifest.xml"))
+}
+
+func TestParseSpec(t *testing.T) {
+	r := Repo{}
+
+	project, path, err := r.parseSpec("gitiles:platform/manifest/+/master/default.xml")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "platform/manifest", project)
+	assert.Equal(t, "master/default.xml", path)
+
+	_, path, err = r.parseSpec("gitiles:platform/manifest/+/refs/heads/main/sub/default.xml")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "refs/heads/main/sub/default.xml", path)
+
+	_, _, err = r.parseSpec("gitiles:platform/manifest/+/master")
+	assert.NotEqual(t, nil, err)
+
+	_, _, err = r.parseSpec("gitiles:platform/manifest/default.xml")
+	assert.NotEqual(t, nil, err)
+
+	_, _, err = r.parseSpec("gitiles:/+/master/default.xml")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestGitilesProject(t *testing.T) {
+	r := Repo{}
+
+	project, err := r.gitilesProject("https://android.googlesource.com/platform/manifest.git",
+		"https://android.googlesource.com/")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "platform/manifest", project)
+
+	project, err = r.gitilesProject("https://android.googlesource.com/a/platform/manifest",
+		"https://android.googlesource.com")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "platform/manifest", project)
+
+	project, err = r.gitilesProject("http://localhost:80/platform/manifest/", "localhost:80")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "platform/manifest", project)
+
+	_, err = r.gitilesProject("https://android.googlesource.com/platform/manifest", "localhost:80")
+	assert.NotEqual(t, nil, err)
+
+	_, err = r.gitilesProject("https://android.googlesource.com", "https://android.googlesource.com")
+	assert.NotEqual(t, nil, err)
+}
+
+func TestManifestOrigin(t *testing.T) {
+	c := config.Gitiles{
+		Url: "https://android.googlesource.com/",
+	}
+
+	r := Repo{}
+
+	assert.Equal(t, "https://android.googlesource.com/platform/manifest",
+		r.manifestOrigin("gitiles:platform/manifest/+/master/default.xml", &c))
+
+	dir := t.TempDir()
+	name := filepath.Join(dir, "manifest.xml")
+	assert.Equal(t, "", r.manifestOrigin(name, &c))
+
+	err := os.MkdirAll(filepath.Join(dir, "manifests.git"), 0755)
+	assert.Equal(t, nil, err)
+
+	err = os.WriteFile(filepath.Join(dir, "manifests.git", "config"), []byte(`[remote "origin"]
+	url = https://android.googlesource.com/a/platform/manifest
+`), 0600)
+	assert.Equal(t, nil, err)
+
+	assert.Equal(t, "https://android.googlesource.com/a/platform/manifest", r.manifestOrigin(name, &c))
+}
+
+func TestGitilesName(t *testing.T) {
+	c := config.Gitiles{
+		Url: "https://android.googlesource.com",
+	}
+
+	m := manifest.Manifest{
+		Remotes: []manifest.Remote{
+			{Name: "aosp", Fetch: ".."},
+			{Name: "mirror", Fetch: "https://android.googlesource.com/mirror"},
+			{Name: "github", Fetch: "https://github.com/"},
+		},
+		Default: &manifest.Default{Remote: "aosp", Revision: "master"},
+	}
+
+	r := Repo{}
+	u := "https://android.googlesource.com/a/platform/manifest"
+
+	assert.Equal(t, "platform/art", r.gitilesName(&m, manifest.Project{Name: "platform/art"}, u, &c))
+	assert.Equal(t, "mirror/platform/art",
+		r.gitilesName(&m, manifest.Project{Name: "platform/art", Remote: "mirror"}, u, &c))
+	assert.Equal(t, "foo/bar", r.gitilesName(&m, manifest.Project{Name: "foo/bar", Remote: "github"}, u, &c))
+	assert.Equal(t, "platform/art", r.gitilesName(&m, manifest.Project{Name: "platform/art"}, "", &c))
+}
+
+func TestSplitRevision(t *testing.T) {
+	s := newGitiles()
+	defer s.Close()
+
+	g := gitiles.Gitiles{}
+
+	err := g.Init(s.URL, "", "")
+	assert.Equal(t, nil, err)
+
+	r := Repo{}
+
+	revision, file, err := r.splitRevision(&g, "platform/manifest", "master/default.xml")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "master", revision)
+	assert.Equal(t, "default.xml", file)
+
+	revision, file, err = r.splitRevision(&g, "platform/manifest", "refs/heads/release/x/sub/default.xml")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "refs/heads/release/x", revision)
+	assert.Equal(t, "sub/default.xml", file)
+
+	revision, file, err = r.splitRevision(&g, "platform/manifest", "release/x/default.xml")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "release/x", revision)
+	assert.Equal(t, "default.xml", file)
+
+	revision, file, err = r.splitRevision(&g, "platform/manifest", "v1/default.xml")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, "v1", revision)
+	assert.Equal(t, "default.xml", file)
+
+	revision, file, err = r.splitRevision(&g, "platform/manifest", strings.Repeat("a", 40)+"/default.xml")
+	assert.Equal(t, nil, err)
+	assert.Equal(t, strings.Repeat("a", 40), revision)
+	assert.Equal(t, "default.xml", file)
+
+	_, _, err = r.splitRevision(&g, "platform/manifest", "none/default.xml")
+	assert.NotEqual(t, nil, err)
+
+	_, _, err = r.splitRevision(&g, "platform/none", "master/default.xml")
+	assert.NotEqual(t, nil, err)
+}
+
 func TestDepthAfterTag(t *testing.T) {
-	// TODO: FIXME
+	s := newGitiles()
+	defer s.Close()
+
+	c := config.Gitiles{
+		Pass: "",
+		Url:  s.URL,
+		User: "",
+	}
+
+	r := Repo{}
+
+	depth, err := r.DepthAfterTag("platform/art", "android10-release", "android10-release", &c)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 4, depth)
+
+	depth, err = r.DepthAfterTag("platform/art", "android10-release", "android10-light", &c)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, depth)
+
+	_, err = r.DepthAfterTag("platform/art", "android10-release", "android11-release", &c)
+	assert.NotEqual(t, nil, err)
 }
 
 func TestShallowAfterTag(t *testing.T) {
-	// TODO: FIXME
+	s := newGitiles()
+	defer s.Close()
+
+	c := config.Gitiles{
+		Pass: "",
+		Url:  s.URL,
+		User: "",
+	}
+
+	orig, err := os.ReadFile("../test/manifest-1.xml")
+	assert.Equal(t, nil, err)
+
+	name := filepath.Join(t.TempDir(), "manifest.xml")
+	err = os.WriteFile(name, orig, 0600)
+	assert.Equal(t, nil, err)
+
+	r := Repo{}
+
+	err = r.ShallowAfterTag(name, "android10-release", "tradefed", false, &c)
+	assert.Equal(t, nil, err)
+
+	buf, err := os.ReadFile(name)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, string(orig), string(buf))
+
+	err = r.ShallowAfterTag(name, "android10-release", "", false, &c)
+	assert.Equal(t, nil, err)
+
+	buf, err = os.ReadFile(name)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, strings.Replace(string(orig), `revision="android10-release"/>`,
+		`revision="android10-release" clone-depth="4"/>`, 1), string(buf))
+
+	name = filepath.Join(t.TempDir(), "manifest.xml")
+	err = os.WriteFile(name, []byte(`<manifest>
+  <default revision="master"/>
+  <project name="platform/art" revision="android10-release"/>
+  <project name="platform/none" revision="android10-release"/>
+</manifest>`), 0600)
+	assert.Equal(t, nil, err)
+
+	err = r.ShallowAfterTag(name, "android10-release", "", false, &c)
+	assert.Equal(t, nil, err)
+
+	buf, err = os.ReadFile(name)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, `<manifest>
+  <default revision="master"/>
+  <project name="platform/art" revision="android10-release" clone-depth="4"/>
+  <project name="platform/none" revision="android10-release"/>
+</manifest>`, string(buf))
+
+	name = filepath.Join(t.TempDir(), "manifest.xml")
+	err = os.WriteFile(name, []byte(`<manifest>
+  <default revision="master"/>
+  <project name="platform/art" revision="android10-release"/>
+</manifest>`), 0600)
+	assert.Equal(t, nil, err)
+
+	err = os.MkdirAll(filepath.Join(filepath.Dir(name), "local_manifests"), 0755)
+	assert.Equal(t, nil, err)
+
+	err = os.WriteFile(filepath.Join(filepath.Dir(name), "local_manifests", "local.xml"),
+		[]byte(`<manifest><extend-project name="platform/art" revision="master"/></manifest>`), 0600)
+	assert.Equal(t, nil, err)
+
+	err = r.ShallowAfterTag(name, "android10-release", "", false, &c)
+	assert.Equal(t, nil, err)
+
+	buf, err = os.ReadFile(name)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, false, strings.Contains(string(buf), "clone-depth"))
+	assert.Equal(t, false, strings.Contains(string(buf), "extend-project"))
 }
 
-func TestDepthAfterTime(t *testing.T) {
+func TestShallowAfterNearestTag(t *testing.T) {
+	s := newGitiles()
+	defer s.Close()
+
 	c := config.Gitiles{
 		Pass: "",
-		Url:  "https://android.googlesource.com",
+		Url:  s.URL,
 		User: "",
 	}
 
+	orig := `<manifest>
+  <default revision="master"/>
+  <project name="platform/art" revision="android10-release"/>
+</manifest>`
+
+	name := filepath.Join(t.TempDir(), "manifest.xml")
+	err := os.WriteFile(name, []byte(orig), 0600)
+	assert.Equal(t, nil, err)
+
 	r := Repo{}
 
-	_, err := r.DepthAfterTime("platform/build/soong", "master", "2020-06-25T00:00:00", &c)
+	err = r.ShallowAfterTag(name, "android11-release", "", false, &c)
+	assert.Equal(t, nil, err)
+
+	buf, err := os.ReadFile(name)
 	assert.Equal(t, nil, err)
+	assert.Equal(t, orig, string(buf))
+
+	err = r.ShallowAfterTag(name, "android11-release", "", true, &c)
+	assert.Equal(t, nil, err)
+
+	buf, err = os.ReadFile(name)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, strings.Replace(orig, `revision="android10-release"/>`,
+		`revision="android10-release" clone-depth="4"/>`, 1), string(buf))
+}
+
+func TestShallowLocalManifests(t *testing.T) {
+	s := newGitiles()
+	defer s.Close()
+
+	c := config.Gitiles{
+		Pass: "",
+		Url:  s.URL,
+		User: "",
+	}
+
+	// What repo manifest --no-local-manifests writes in Init, which leaves the
+	// local manifests out of manifest.xml.
+	orig := `<?xml version="1.0" encoding="UTF-8"?>
+<manifest>
+  <remote name="aosp" fetch=".." review="https://android-review.googlesource.com/"/>
+
+  <default revision="master" remote="aosp"/>
+
+  <project name="platform/art" path="art" revision="android10-release"/>
+  <project name="platform/build" path="build/make" revision="android10-release"/>
+</manifest>
+`
+
+	local := `<manifest>
+  <remove-project name="platform/build"/>
+  <extend-project name="platform/art" path="art" dest-path="moved"/>
+  <project name="platform/art" path="art2" revision="android10-release"/>
+</manifest>`
+
+	dir := t.TempDir()
+	name := filepath.Join(dir, "manifest.xml")
+
+	err := os.WriteFile(name, []byte(orig), 0600)
+	assert.Equal(t, nil, err)
+
+	err = os.MkdirAll(filepath.Join(dir, "local_manifests"), 0755)
+	assert.Equal(t, nil, err)
+
+	err = os.WriteFile(filepath.Join(dir, "local_manifests", "local.xml"), []byte(local), 0600)
+	assert.Equal(t, nil, err)
+
+	r := Repo{}
+
+	err = r.ShallowAfterTag(name, "android10-release", "", false, &c)
+	assert.Equal(t, nil, err)
+
+	buf, err := os.ReadFile(name)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, strings.Replace(orig, `path="art" revision="android10-release"/>`,
+		`path="art" revision="android10-release" clone-depth="4"/>`, 1), string(buf))
+
+	buf, err = os.ReadFile(filepath.Join(dir, "local_manifests", "local.xml"))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, local, string(buf))
+
+	m, err := r.LoadManifest(name, &c)
+	assert.Equal(t, nil, err)
+
+	err = m.Overlay(manifest.LocalDir(name))
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 2, len(m.Projects))
+}
+
+func TestShallowNested(t *testing.T) {
+	s := newGitiles()
+	defer s.Close()
+
+	c := config.Gitiles{
+		Pass: "",
+		Url:  s.URL,
+		User: "",
+	}
+
+	orig := `<manifest>
+  <default revision="master"/>
+  <project name="platform/build" path="build/make">
+    <project name="blueprint"/>
+  </project>
+</manifest>`
+
+	name := filepath.Join(t.TempDir(), "manifest.xml")
+	err := os.WriteFile(name, []byte(orig), 0600)
+	assert.Equal(t, nil, err)
+
+	r := Repo{}
+
+	err = r.ShallowAfterTime(name, "2020-05-01T00:00:00", "", &c)
+	assert.Equal(t, nil, err)
+
+	buf, err := os.ReadFile(name)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, `<manifest>
+  <default revision="master"/>
+  <project name="platform/build" path="build/make" clone-depth="1">
+    <project name="blueprint" clone-depth="1"/>
+  </project>
+</manifest>`, string(buf))
 }
 
 func TestShallowAfterTime(t *testing.T) {
@@ -87,8 +535,15 @@ func TestShallowAfterTime(t *testing.T) {
 		User: "",
 	}
 
+	buf, err := os.ReadFile("../test/manifest-1.xml")
+	assert.Equal(t, nil, err)
+
+	name := filepath.Join(t.TempDir(), "manifest.xml")
+	err = os.WriteFile(name, buf, 0600)
+	assert.Equal(t, nil, err)
+
 	r := Repo{}
 
-	err := r.ShallowAfterTime("../test/manifest-1.xml", "2020-06-25T00:00:00", &c)
+	err = r.ShallowAfterTime(name, "2020-06-25T00:00:00", "", &c)
 	assert.Equal(t, nil, err)
 }
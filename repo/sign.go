@@ -0,0 +1,183 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"gorepo/manifest"
+)
+
+const (
+	FormatOpenPGP = "openpgp"
+	FormatSSH     = "ssh"
+)
+
+const (
+	statusExpired    = "[GNUPG:] EXPSIG "
+	statusExpiredKey = "[GNUPG:] EXPKEYSIG "
+	statusGood       = "[GNUPG:] GOODSIG "
+	statusRevokedKey = "[GNUPG:] REVKEYSIG "
+	statusValid      = "[GNUPG:] VALIDSIG "
+)
+
+const (
+	sigOpenPGP   = ".asc"
+	sigSSH       = ".sig"
+	sshNamespace = "gorepo-manifest"
+)
+
+// Signature returns the detached signature file of manifest name in format,
+// which is name.asc for OpenPGP and name.sig for SSH.
+func (r Repo) Signature(name, format string) string {
+	if format == FormatSSH {
+		return name + sigSSH
+	}
+
+	return name + sigOpenPGP
+}
+
+// Sign writes the detached signature of manifest name in format with key,
+// which is the key ID of gpg for OpenPGP and the private key file for SSH.
+// nolint: gosec
+func (r Repo) Sign(name, format, key string) error {
+	var cmd *exec.Cmd
+
+	switch format {
+	case FormatOpenPGP:
+		args := []string{"--batch", "--yes", "--armor", "--detach-sign", "--output", r.Signature(name, format)}
+		if key != "" {
+			args = append(args, "--local-user", key)
+		}
+		cmd = exec.Command("gpg", append(args, name)...)
+	case FormatSSH:
+		if key == "" {
+			return errors.New("key required")
+		}
+		_ = os.Remove(r.Signature(name, format))
+		cmd = exec.Command("ssh-keygen", "-Y", "sign", "-f", key, "-n", sshNamespace, name)
+	default:
+		return errors.New("format invalid")
+	}
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return errors.Wrap(err, "sign failed: "+strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
+
+// Verify verifies the detached signature of manifest name in format against
+// keyring of trusted signers, which is a file of public keys exported by gpg
+// for OpenPGP, and an allowed signers file of ssh-keygen for SSH.
+func (r Repo) Verify(name, format, keyring string) error {
+	if keyring == "" {
+		return errors.New("keyring required")
+	}
+
+	if _, err := os.Stat(r.Signature(name, format)); err != nil {
+		return errors.Wrap(err, "signature not found")
+	}
+
+	switch format {
+	case FormatOpenPGP:
+		return r.verifyOpenPGP(name, keyring)
+	case FormatSSH:
+		return r.verifySSH(name, keyring)
+	}
+
+	return errors.New("format invalid")
+}
+
+// VerifyManifest verifies every manifest file read loading manifest name and
+// overlaying it with the local manifests in dir like Verify does, so that
+// neither includes nor local manifests go in unsigned. Dir is skipped if empty.
+func (r Repo) VerifyManifest(name, dir, format, keyring string) error {
+	files, err := manifest.Files(name, dir)
+	if err != nil {
+		return errors.Wrap(err, "load failed")
+	}
+
+	for _, val := range files {
+		if err := r.Verify(val, format, keyring); err != nil {
+			return errors.Wrap(err, val)
+		}
+	}
+
+	return nil
+}
+
+// verifyOpenPGP imports keyring into a temporary home of gpg, which makes
+// the keys in keyring the only ones trusted.
+// nolint: gosec
+func (r Repo) verifyOpenPGP(name, keyring string) error {
+	home, err := os.MkdirTemp("", "gorepo-gpg")
+	if err != nil {
+		return errors.Wrap(err, "mkdir failed")
+	}
+
+	defer func() {
+		_ = os.RemoveAll(home)
+	}()
+
+	if out, err := exec.Command("gpg", "--batch", "--homedir", home, "--import", keyring).CombinedOutput(); err != nil {
+		return errors.Wrap(err, "import failed: "+strings.TrimSpace(string(out)))
+	}
+
+	cmd := exec.Command("gpg", "--batch", "--homedir", home, "--status-fd", "1",
+		"--verify", r.Signature(name, FormatOpenPGP), name)
+
+	out, err := cmd.Output()
+	if err != nil || !bytes.Contains(out, []byte(statusGood)) || !bytes.Contains(out, []byte(statusValid)) {
+		return errors.New("signature invalid")
+	}
+
+	for _, val := range []string{statusExpiredKey, statusRevokedKey, statusExpired} {
+		if bytes.Contains(out, []byte(val)) {
+			return errors.New("signature invalid: " + strings.TrimSpace(strings.TrimPrefix(val, "[GNUPG:]")))
+		}
+	}
+
+	return nil
+}
+
+// nolint: gosec
+func (r Repo) verifySSH(name, keyring string) error {
+	sig := r.Signature(name, FormatSSH)
+
+	out, err := exec.Command("ssh-keygen", "-Y", "find-principals", "-f", keyring, "-s", sig).Output()
+	if err != nil {
+		return errors.New("signer not trusted")
+	}
+
+	principal := strings.SplitN(strings.TrimSpace(string(out)), "\n", 2)[0]
+
+	buf, err := os.ReadFile(name)
+	if err != nil {
+		return errors.Wrap(err, "read failed")
+	}
+
+	cmd := exec.Command("ssh-keygen", "-Y", "verify", "-f", keyring, "-I", principal, "-n", sshNamespace, "-s", sig)
+	cmd.Stdin = bytes.NewReader(buf)
+
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return errors.Wrap(err, "signature invalid: "+strings.TrimSpace(string(out)))
+	}
+
+	return nil
+}
@@ -0,0 +1,279 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	signer = "gorepo@example.com"
+)
+
+func newManifest(t *testing.T) string {
+	name := filepath.Join(t.TempDir(), "default.xml")
+
+	err := os.WriteFile(name, []byte(`<manifest><project name="platform/art"/></manifest>`), 0600)
+	assert.Equal(t, nil, err)
+
+	return name
+}
+
+func TestSignature(t *testing.T) {
+	r := Repo{}
+
+	assert.Equal(t, "default.xml.asc", r.Signature("default.xml", FormatOpenPGP))
+	assert.Equal(t, "default.xml.sig", r.Signature("default.xml", FormatSSH))
+}
+
+func TestSignOpenPGP(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg not found")
+	}
+
+	home := t.TempDir()
+	t.Setenv("GNUPGHOME", home)
+	t.Cleanup(func() {
+		_ = exec.Command("gpgconf", "--kill", "gpg-agent").Run()
+	})
+
+	out, err := exec.Command("gpg", "--batch", "--passphrase", "", "--quick-gen-key",
+		"gorepo <"+signer+">", "ed25519", "sign", "never").CombinedOutput()
+	assert.Equal(t, nil, err, string(out))
+
+	keyring := filepath.Join(t.TempDir(), "keyring.gpg")
+	out, err = exec.Command("gpg", "--batch", "--output", keyring, "--export", signer).CombinedOutput()
+	assert.Equal(t, nil, err, string(out))
+
+	r := Repo{}
+	name := newManifest(t)
+
+	err = r.Verify(name, FormatOpenPGP, keyring)
+	assert.NotEqual(t, nil, err)
+
+	err = r.Sign(name, FormatOpenPGP, signer)
+	assert.Equal(t, nil, err)
+
+	err = r.Verify(name, FormatOpenPGP, keyring)
+	assert.Equal(t, nil, err)
+
+	err = os.WriteFile(keyring, nil, 0600)
+	assert.Equal(t, nil, err)
+
+	err = r.Verify(name, FormatOpenPGP, keyring)
+	assert.NotEqual(t, nil, err)
+
+	err = r.Sign(name, FormatOpenPGP, "none@example.com")
+	assert.NotEqual(t, nil, err)
+
+	out, err = exec.Command("gpg", "--batch", "--output", keyring, "--yes", "--export", signer).CombinedOutput()
+	assert.Equal(t, nil, err, string(out))
+
+	err = os.WriteFile(name, []byte(`<manifest><project name="platform/build"/></manifest>`), 0600)
+	assert.Equal(t, nil, err)
+
+	err = r.Verify(name, FormatOpenPGP, keyring)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestSignSSH(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not found")
+	}
+
+	dir := t.TempDir()
+	key := filepath.Join(dir, "id_ed25519")
+
+	out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", signer, "-f", key).CombinedOutput()
+	assert.Equal(t, nil, err, string(out))
+
+	pub, err := os.ReadFile(key + ".pub")
+	assert.Equal(t, nil, err)
+
+	keyring := filepath.Join(dir, "allowed_signers")
+	err = os.WriteFile(keyring, append([]byte(signer+" "), pub...), 0600)
+	assert.Equal(t, nil, err)
+
+	r := Repo{}
+	name := newManifest(t)
+
+	err = r.Sign(name, FormatSSH, "")
+	assert.NotEqual(t, nil, err)
+
+	err = r.Sign(name, FormatSSH, key)
+	assert.Equal(t, nil, err)
+
+	err = r.Verify(name, FormatSSH, keyring)
+	assert.Equal(t, nil, err)
+
+	err = r.Sign(name, FormatSSH, key)
+	assert.Equal(t, nil, err)
+
+	err = os.WriteFile(name, []byte(`<manifest><project name="platform/build"/></manifest>`), 0600)
+	assert.Equal(t, nil, err)
+
+	err = r.Verify(name, FormatSSH, keyring)
+	assert.NotEqual(t, nil, err)
+
+	other := filepath.Join(dir, "other")
+	err = os.WriteFile(other, nil, 0600)
+	assert.Equal(t, nil, err)
+
+	err = r.Verify(name, FormatSSH, other)
+	assert.NotEqual(t, nil, err)
+
+	err = r.Verify(name, FormatSSH, "")
+	assert.NotEqual(t, nil, err)
+
+	err = r.Verify(name, "none", keyring)
+	assert.NotEqual(t, nil, err)
+
+	err = r.Sign(name, "none", key)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestVerifyOpenPGPInvalidKey(t *testing.T) {
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg not found")
+	}
+
+	home := t.TempDir()
+	t.Setenv("GNUPGHOME", home)
+	t.Cleanup(func() {
+		_ = exec.Command("gpgconf", "--kill", "gpg-agent").Run()
+	})
+
+	past := "--faked-system-time=20200101T000000!"
+
+	out, err := exec.Command("gpg", "--batch", "--passphrase", "", past, "--quick-gen-key",
+		"gorepo <"+signer+">", "ed25519", "sign", "1d").CombinedOutput()
+	assert.Equal(t, nil, err, string(out))
+
+	r := Repo{}
+	name := newManifest(t)
+
+	out, err = exec.Command("gpg", "--batch", past, "--local-user", signer, "--armor",
+		"--output", r.Signature(name, FormatOpenPGP), "--detach-sign", name).CombinedOutput()
+	assert.Equal(t, nil, err, string(out))
+
+	keyring := filepath.Join(t.TempDir(), "keyring.gpg")
+	out, err = exec.Command("gpg", "--batch", "--output", keyring, "--export", signer).CombinedOutput()
+	assert.Equal(t, nil, err, string(out))
+
+	err = r.Verify(name, FormatOpenPGP, keyring)
+	assert.NotEqual(t, nil, err)
+
+	out, err = exec.Command("gpg", "--batch", "--yes", "--passphrase", "", "--quick-gen-key",
+		"revoked <revoked@example.com>", "ed25519", "sign", "never").CombinedOutput()
+	assert.Equal(t, nil, err, string(out))
+
+	err = r.Sign(name, FormatOpenPGP, "revoked@example.com")
+	assert.Equal(t, nil, err)
+
+	out, err = exec.Command("gpg", "--batch", "--output", keyring, "--yes", "--export", "revoked@example.com").CombinedOutput()
+	assert.Equal(t, nil, err, string(out))
+
+	err = r.Verify(name, FormatOpenPGP, keyring)
+	assert.Equal(t, nil, err)
+
+	revs, err := filepath.Glob(filepath.Join(home, "openpgp-revocs.d", "*.rev"))
+	assert.Equal(t, nil, err)
+
+	for _, val := range revs {
+		buf, err := os.ReadFile(val)
+		assert.Equal(t, nil, err)
+		cmd := exec.Command("gpg", "--batch", "--import")
+		cmd.Stdin = bytes.NewReader(bytes.Replace(buf, []byte(":-----BEGIN"), []byte("-----BEGIN"), 1))
+		out, err = cmd.CombinedOutput()
+		assert.Equal(t, nil, err, string(out))
+	}
+
+	out, err = exec.Command("gpg", "--batch", "--output", keyring, "--yes", "--export", "revoked@example.com").CombinedOutput()
+	assert.Equal(t, nil, err, string(out))
+
+	err = r.Verify(name, FormatOpenPGP, keyring)
+	assert.NotEqual(t, nil, err)
+}
+
+func TestVerifyManifest(t *testing.T) {
+	if _, err := exec.LookPath("ssh-keygen"); err != nil {
+		t.Skip("ssh-keygen not found")
+	}
+
+	dir := t.TempDir()
+	key := filepath.Join(dir, "id_ed25519")
+
+	out, err := exec.Command("ssh-keygen", "-q", "-t", "ed25519", "-N", "", "-C", signer, "-f", key).CombinedOutput()
+	assert.Equal(t, nil, err, string(out))
+
+	pub, err := os.ReadFile(key + ".pub")
+	assert.Equal(t, nil, err)
+
+	keyring := filepath.Join(dir, "allowed_signers")
+	err = os.WriteFile(keyring, append([]byte(signer+" "), pub...), 0600)
+	assert.Equal(t, nil, err)
+
+	manifests := filepath.Join(dir, "manifests")
+	local := filepath.Join(dir, "local_manifests")
+
+	for _, val := range []string{manifests, local} {
+		err = os.MkdirAll(val, 0755)
+		assert.Equal(t, nil, err)
+	}
+
+	name := filepath.Join(manifests, "default.xml")
+	include := filepath.Join(manifests, "common.xml")
+	extra := filepath.Join(local, "local.xml")
+
+	err = os.WriteFile(name, []byte(`<manifest><include name="common.xml"/></manifest>`), 0600)
+	assert.Equal(t, nil, err)
+	err = os.WriteFile(include, []byte(`<manifest><project name="platform/art"/></manifest>`), 0600)
+	assert.Equal(t, nil, err)
+	err = os.WriteFile(extra, []byte(`<manifest><project name="platform/build"/></manifest>`), 0600)
+	assert.Equal(t, nil, err)
+
+	r := Repo{}
+
+	err = r.Sign(name, FormatSSH, key)
+	assert.Equal(t, nil, err)
+
+	err = r.Verify(name, FormatSSH, keyring)
+	assert.Equal(t, nil, err)
+
+	err = r.VerifyManifest(name, local, FormatSSH, keyring)
+	assert.NotEqual(t, nil, err)
+
+	err = r.Sign(include, FormatSSH, key)
+	assert.Equal(t, nil, err)
+
+	err = r.VerifyManifest(name, "", FormatSSH, keyring)
+	assert.Equal(t, nil, err)
+
+	err = r.VerifyManifest(name, local, FormatSSH, keyring)
+	assert.NotEqual(t, nil, err)
+
+	err = r.Sign(extra, FormatSSH, key)
+	assert.Equal(t, nil, err)
+
+	err = r.VerifyManifest(name, local, FormatSSH, keyring)
+	assert.Equal(t, nil, err)
+
+	err = r.VerifyManifest(filepath.Join(manifests, "none.xml"), local, FormatSSH, keyring)
+	assert.NotEqual(t, nil, err)
+}
@@ -0,0 +1,135 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/pkg/errors"
+
+	"gorepo/config"
+	"gorepo/gitiles"
+	"gorepo/manifest"
+)
+
+// CheckTag checks that tag exists in the projects of manifest name, loaded by
+// LoadManifest and overlaid with local manifests unless on Gitiles, selected
+// by groups and not pinned to SHA1. It returns the projects without tag mapped
+// to their nearest tags, which are empty if they have none, and the projects
+// whose tags cannot be listed, both by their names on Gitiles.
+func (r Repo) CheckTag(name, tag, groups string, c *config.Gitiles) (map[string]string, []string, error) {
+	g := gitiles.Gitiles{}
+
+	if err := g.Init(c.Url, c.User, c.Pass); err != nil {
+		return nil, nil, errors.Wrap(err, "init failed")
+	}
+
+	m, err := r.LoadManifest(name, c)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "load failed")
+	}
+
+	if !r.IsGitiles(name) {
+		if err := m.Overlay(manifest.LocalDir(name)); err != nil {
+			return nil, nil, errors.Wrap(err, "overlay failed")
+		}
+	}
+
+	var failed []string
+
+	u := r.manifestOrigin(name, c)
+	missing := map[string]string{}
+	checked := map[string]bool{}
+
+	for _, val := range m.Select(manifest.Groups(groups)) {
+		rev, err := m.Revision(val)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "revision failed")
+		}
+		if manifest.RevisionType(rev) == manifest.TypeSha {
+			continue
+		}
+		project := r.gitilesName(&m, val, u, c)
+		if checked[project] {
+			continue
+		}
+		checked[project] = true
+		tags, err := r.tags(&g, project)
+		if err != nil {
+			failed = append(failed, project)
+			continue
+		}
+		if _, ok := tags[tag]; !ok {
+			missing[project] = r.nearestTag(tags, tag)
+		}
+	}
+
+	sort.Strings(failed)
+
+	return missing, failed, nil
+}
+
+// tags returns the tags of project mapped to their commits.
+func (r Repo) tags(g *gitiles.Gitiles, project string) (map[string]string, error) {
+	names, err := g.Refs(project, refsTags)
+	if err != nil {
+		return nil, errors.Wrap(err, "refs failed")
+	}
+
+	buf := map[string]string{}
+
+	for key, val := range names {
+		buf[key] = val.Peeled
+		if val.Peeled == "" {
+			buf[key] = val.Value
+		}
+	}
+
+	return buf, nil
+}
+
+// nearestTag returns the highest tag in tags before tag in natural order, or
+// the lowest one after it if none, among the ones sharing the leading
+// non-digits of tag, like android- of android-10.0.0_r1, or all of tag
+// without digits.
+func (r Repo) nearestTag(tags map[string]string, tag string) string {
+	var before, after string
+
+	stem := tag
+	if index := strings.IndexFunc(tag, unicode.IsDigit); index >= 0 {
+		stem = tag[:index]
+	}
+
+	for key := range tags {
+		if !strings.HasPrefix(key, stem) {
+			continue
+		}
+		if n := manifest.CompareNatural(key, tag); n < 0 {
+			if before == "" || manifest.CompareNatural(key, before) > 0 {
+				before = key
+			}
+		} else if n > 0 {
+			if after == "" || manifest.CompareNatural(key, after) < 0 {
+				after = key
+			}
+		}
+	}
+
+	if before != "" {
+		return before
+	}
+
+	return after
+}
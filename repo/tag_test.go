@@ -0,0 +1,100 @@
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"gorepo/config"
+)
+
+func TestCheckTag(t *testing.T) {
+	s := newGitiles()
+	defer s.Close()
+
+	c := config.Gitiles{
+		Pass: "",
+		Url:  s.URL,
+		User: "",
+	}
+
+	name := filepath.Join(t.TempDir(), "manifest.xml")
+	err := os.WriteFile(name, []byte(`<manifest>
+  <default revision="master"/>
+  <project name="platform/art" revision="android10-release" groups="art"/>
+  <project name="platform/build" path="build/make"/>
+  <project name="platform/build/blueprint" revision="`+strings.Repeat("b", 40)+`"/>
+</manifest>`), 0600)
+	assert.Equal(t, nil, err)
+
+	r := Repo{}
+
+	missing, failed, err := r.CheckTag(name, "android10-release", "", &c)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, map[string]string{"platform/build": ""}, missing)
+	assert.Equal(t, 0, len(failed))
+
+	missing, failed, err = r.CheckTag(name, "android11-release", "art", &c)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, map[string]string{"platform/art": "android10-release"}, missing)
+
+	missing, failed, err = r.CheckTag(name, "android10-light", "art", &c)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(missing))
+
+	_, _, err = r.CheckTag(filepath.Join(t.TempDir(), "none.xml"), "android10-release", "", &c)
+	assert.NotEqual(t, nil, err)
+
+	err = os.WriteFile(name, []byte(`<manifest>
+  <default revision="master"/>
+  <project name="platform/art" revision="android10-release"/>
+  <project name="platform/none"/>
+</manifest>`), 0600)
+	assert.Equal(t, nil, err)
+
+	missing, failed, err = r.CheckTag(name, "android10-release", "", &c)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, 0, len(missing))
+	assert.Equal(t, []string{"platform/none"}, failed)
+
+	missing, failed, err = r.CheckTag("gitiles:platform/manifest/+/refs/tags/v1/default.xml", "android10-release", "", &c)
+	assert.Equal(t, nil, err)
+	assert.Equal(t, map[string]string{"platform/build": ""}, missing)
+	assert.Equal(t, 0, len(failed))
+}
+
+func TestNearestTag(t *testing.T) {
+	tags := map[string]string{
+		"android-10.0.0_r9":  "c1",
+		"android-10.0.0_r10": "c2",
+		"android-11.0.0_r1":  "c3",
+		"v1.0":               "c4",
+		"stable-2":           "c5",
+	}
+
+	r := Repo{}
+
+	assert.Equal(t, "android-10.0.0_r10", r.nearestTag(tags, "android-10.0.0_r11"))
+	assert.Equal(t, "android-10.0.0_r9", r.nearestTag(tags, "android-10.0.0_r9a"))
+	assert.Equal(t, "android-10.0.0_r9", r.nearestTag(tags, "android-9.0.0_r1"))
+	assert.Equal(t, "android-11.0.0_r1", r.nearestTag(tags, "android-12.0.0_r1"))
+	assert.Equal(t, "v1.0", r.nearestTag(tags, "v2.0"))
+	assert.Equal(t, "stable-2", r.nearestTag(tags, "stable"))
+	assert.Equal(t, "", r.nearestTag(tags, "release-1"))
+	assert.Equal(t, "", r.nearestTag(map[string]string{}, "v1.0"))
+}